@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/control"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+	"github.com/SiirRandall/tesmart-ui/internal/preset"
+	"github.com/SiirRandall/tesmart-ui/internal/protocol"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+)
+
+// Exit codes of the headless commands.
+const (
+	exitOK          = 0
+	exitFailed      = 1 // the switch answered, but not as expected
+	exitUsage       = 2 // bad arguments or config
+	exitUnreachable = 3 // the switch could not be reached or timed out
+)
+
+type cliCommand struct {
+	args  string // positional arguments, for usage text
+	about string
+	run   func(t *target, args []string, r *schema.Result) error
+}
+
+var cliCommands = map[string]cliCommand{
+	"status": {"", "print the active input", cmdStatus},
+	"switch": {"<port|name>", "select an input by number or name", cmdSwitch},
+	"ping":   {"", "check that the switch answers", cmdPing},
+	"buzzer": {"on|off", "unmute or mute the buzzer", cmdBuzzer},
+	"led":    {"off|10s|30s", "set the panel LED timeout", cmdLED},
+	"netcfg": {"get | set [ip=..] [port=..] [mask=..] [gw=..]", "read or change the switch's network settings", cmdNetcfg},
+	"raw":    {"<hex>", "send a raw frame and print the reply", cmdRaw},
+	"preset": {"<name>", "run a preset from the config", cmdPreset},
+}
+
+// usageError marks errors that should exit with exitUsage.
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
+
+func usagef(format string, args ...any) error { return usageError{fmt.Sprintf(format, args...)} }
+
+// target is the switch a command talks to.
+type target struct {
+	ctx context.Context
+	cfg *config.Config
+	dc  *config.Device // never saved; may be a copy with -ip/-port applied
+	dev *device.Device
+
+	// lookup finds the other switches a preset names; "" is dev.
+	lookup preset.Lookup
+}
+
+// runCLI parses the common flags, resolves the target switch and runs cmd.
+func runCLI(name string, cmd cliCommand, args []string) int {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	devName := fs.String("device", "", "name of the configured switch to use (default: the first)")
+	ip := fs.String("ip", "", "talk to this IP instead of the configured one")
+	port := fs.Int("port", 0, "TCP port to use with -ip (default: configured, or 5000)")
+	timeout := fs.Duration("timeout", 0, "give up after this long (default: no limit beyond per-command timeouts)")
+	output := fs.String("output", "text", "output format: text, json or yaml")
+	fs.StringVar(output, "o", "text", "shorthand for -output")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tesmart-ui %s [flags] %s\n\n%s.\n\nflags:\n", name, cmd.args, cmd.about)
+		fs.PrintDefaults()
+	}
+
+	// Allow flags after positional arguments ("switch 3 -device Rack").
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return exitOK
+			}
+			return exitUsage
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		pos, args = append(pos, args[0]), args[1:]
+	}
+
+	if _, ok := emitters[*output]; !ok {
+		fmt.Fprintf(os.Stderr, "%s: unknown output format %q (want text, json or yaml)\n", name, *output)
+		return exitUsage
+	}
+	r := schema.New(name)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	// A running instance owns the switch; let it do the talking. -ip/-port
+	// name a switch it may not know, so those always connect directly.
+	if *ip == "" && *port == 0 {
+		fr, err := control.Send(ctx, control.Request{Command: name, Device: *devName, Args: pos, Timeout: timeout.Milliseconds()})
+		if err == nil {
+			return emit(*output, fr, fs)
+		}
+		if !errors.Is(err, control.ErrNotRunning) {
+			return finish(*output, r, fs, err)
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return finish(*output, r, fs, usagef("config error: %v", err))
+	}
+	src := cfg.Devices[0]
+	if *devName != "" {
+		if src = cfg.Device(*devName); src == nil {
+			return finish(*output, r, fs, usagef("no switch named %q in %s", *devName, cfg.Path()))
+		}
+	}
+	dc := *src
+	if *ip != "" {
+		dc.Transport, dc.IP = "tcp", *ip
+	}
+	if *port != 0 {
+		dc.Port = *port
+	}
+
+	dev := device.New(&dc, cfg.SwitchSuppress())
+	defer dev.Close()
+	others := map[string]*device.Device{}
+	defer func() {
+		for _, d := range others {
+			d.Close()
+		}
+	}()
+	lookup := func(name string) *device.Device {
+		if name == "" || name == dc.Name {
+			return dev
+		}
+		if d, ok := others[name]; ok {
+			return d
+		}
+		c := cfg.Device(name)
+		if c == nil {
+			return nil
+		}
+		others[name] = device.New(c, cfg.SwitchSuppress())
+		return others[name]
+	}
+
+	r.Device, r.Target = dc.Name, dc.Target()
+	err = cmd.run(&target{ctx: ctx, cfg: cfg, dc: &dc, dev: dev, lookup: lookup}, pos, r)
+	return finish(*output, r, fs, err)
+}
+
+// finish records err in r, writes r in the chosen format and picks the exit
+// code.
+func finish(format string, r *schema.Result, fs *flag.FlagSet, err error) int {
+	record(r, err)
+	return emit(format, r, fs)
+}
+
+// record sets r.Error from err, if any.
+func record(r *schema.Result, err error) {
+	var ue usageError
+	switch {
+	case err == nil:
+	case errors.As(err, &ue):
+		r.Error = &schema.Error{Kind: schema.KindUsage, Message: ue.msg}
+	default:
+		r.Error = schema.NewError(err)
+	}
+}
+
+// emit writes r in the chosen format and returns the exit code for it.
+func emit(format string, r *schema.Result, fs *flag.FlagSet) int {
+	code := exitCode(r)
+	if werr := emitters[format](os.Stdout, r); werr != nil {
+		fmt.Fprintln(os.Stderr, werr)
+		return exitFailed
+	}
+	if code == exitUsage && format == "text" && fs != nil {
+		fs.Usage()
+	}
+	return code
+}
+
+func exitCode(r *schema.Result) int {
+	if r.Error == nil {
+		return exitOK
+	}
+	switch r.Error.Kind {
+	case schema.KindUsage, schema.KindNotFound:
+		return exitUsage
+	case schema.KindUnreachable, schema.KindTimeout, schema.KindCancelled:
+		return exitUnreachable
+	}
+	return exitFailed
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: tesmart-ui [command] [flags] [args]")
+	fmt.Fprintln(os.Stderr, "\nWithout a command the GUI starts. Commands:")
+	names := make([]string, 0, len(cliCommands))
+	for n := range cliCommands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", n, cliCommands[n].about)
+	}
+	fmt.Fprintf(os.Stderr, "  %-8s %s\n", "serve", "poll in the background and serve the HTTP API")
+	fmt.Fprintf(os.Stderr, "  %-8s %s\n", control.CmdShow, "show the running instance's window")
+	fmt.Fprintf(os.Stderr, "  %-8s %s\n", control.CmdReload, "make the running instance re-read its config")
+	fmt.Fprintf(os.Stderr, "  %-8s %s\n", "simulate", "run a simulated switch")
+	fmt.Fprintln(os.Stderr, "\nRun 'tesmart-ui <command> -h' for its flags.")
+}
+
+/* Commands */
+
+func wantArgs(args []string, n int) error {
+	if len(args) != n {
+		return usagef("expected %d argument(s), got %d", n, len(args))
+	}
+	return nil
+}
+
+func (t *target) input(port int) schema.Input {
+	return schema.Input{Port: port, Name: t.dc.InputName(port)}
+}
+
+func cmdStatus(t *target, args []string, r *schema.Result) error {
+	if err := wantArgs(args, 0); err != nil {
+		return err
+	}
+	p, err := t.dev.Cli.GetActiveInputContext(t.ctx)
+	if err != nil {
+		return err
+	}
+	r.Status = &schema.Status{Active: t.input(p)}
+	return nil
+}
+
+func cmdSwitch(t *target, args []string, r *schema.Result) error {
+	if err := wantArgs(args, 1); err != nil {
+		return err
+	}
+	p, err := t.dc.ResolveInput(args[0])
+	if err != nil {
+		return usagef("%v", err)
+	}
+	res, err := t.dev.SwitchContext(t.ctx, p, t.cfg.VerifySwitch(), schema.SourceCLI)
+	if err != nil {
+		return err
+	}
+	r.Switch = &schema.Switch{Active: t.input(p), Result: schema.SwitchSent}
+	switch res {
+	case device.Verified:
+		r.Switch.Result = schema.SwitchVerified
+	case device.Unverified:
+		r.Switch.Result = schema.SwitchUnverified
+	}
+	return nil
+}
+
+func cmdPing(t *target, args []string, r *schema.Result) error {
+	if err := wantArgs(args, 0); err != nil {
+		return err
+	}
+	start := time.Now()
+	if err := t.dev.Cli.PingContext(t.ctx); err != nil {
+		return err
+	}
+	r.Ping = schema.NewPing(time.Since(start))
+	return nil
+}
+
+func cmdBuzzer(t *target, args []string, r *schema.Result) error {
+	if err := wantArgs(args, 1); err != nil {
+		return err
+	}
+	var on bool
+	switch args[0] {
+	case "on":
+		on = true
+	case "off":
+	default:
+		return usagef("buzzer takes on or off, not %q", args[0])
+	}
+	if err := t.dev.Cli.SetBuzzerContext(t.ctx, on); err != nil {
+		return err
+	}
+	r.Setting = &schema.Setting{Name: "buzzer", Value: args[0]}
+	return nil
+}
+
+func cmdLED(t *target, args []string, r *schema.Result) error {
+	if err := wantArgs(args, 1); err != nil {
+		return err
+	}
+	m, ok := protocol.ParseLEDTimeout(args[0])
+	if !ok {
+		return usagef("led takes off, 10s or 30s, not %q", args[0])
+	}
+	if err := t.dev.Cli.SetLEDTimeoutContext(t.ctx, m); err != nil {
+		return err
+	}
+	r.Setting = &schema.Setting{Name: "led_timeout", Value: args[0]}
+	return nil
+}
+
+func cmdNetcfg(t *target, args []string, r *schema.Result) error {
+	if len(args) == 0 {
+		return usagef("netcfg takes get or set")
+	}
+	set := map[string]string{}
+	switch args[0] {
+	case "get":
+		if err := wantArgs(args[1:], 0); err != nil {
+			return err
+		}
+	case "set":
+		if len(args) == 1 {
+			return usagef("netcfg set needs at least one of ip=, port=, mask=, gw=")
+		}
+		for _, kv := range args[1:] {
+			k, v, _ := strings.Cut(kv, "=")
+			switch k {
+			case "ip", "mask", "gw":
+				if net.ParseIP(v).To4() == nil {
+					return usagef("invalid %s %q (want a dotted IPv4 address)", k, v)
+				}
+			case "port":
+				if p, err := strconv.Atoi(v); err != nil || p < 1 || p > 65535 {
+					return usagef("invalid port %q", v)
+				}
+			default:
+				return usagef("unknown setting %q (want ip=, port=, mask= or gw=)", kv)
+			}
+			set[k] = v
+		}
+	default:
+		return usagef("netcfg takes get or set, not %q", args[0])
+	}
+
+	// Settings not given on the command line keep their current values.
+	cur, err := t.dev.Cli.GetNetworkConfigASCIIContext(t.ctx)
+	if err != nil {
+		return err
+	}
+	if len(set) > 0 {
+		if v, ok := set["ip"]; ok {
+			cur.IP = v
+		}
+		if v, ok := set["mask"]; ok {
+			cur.Mask = v
+		}
+		if v, ok := set["gw"]; ok {
+			cur.GW = v
+		}
+		if v, ok := set["port"]; ok {
+			cur.Port, _ = strconv.Atoi(v)
+		}
+		if err := t.dev.Cli.SetNetworkConfigASCIIContext(t.ctx, cur.IP, cur.Port, cur.Mask, cur.GW); err != nil {
+			return err
+		}
+	}
+	r.NetConfig = schema.NewNetConfig(cur, len(set) > 0)
+	return nil
+}
+
+func cmdRaw(t *target, args []string, r *schema.Result) error {
+	if len(args) == 0 {
+		return usagef("raw needs a hex frame, e.g. AABB031000EE")
+	}
+	frame := strings.Join(args, "")
+	if _, err := hex.DecodeString(frame); err != nil {
+		return usagef("invalid hex %q", frame)
+	}
+	reply, err := t.dev.Cli.RawHexSendContext(t.ctx, frame, 1200*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	r.Raw = &schema.Raw{Sent: strings.ToUpper(frame), Reply: reply}
+	return nil
+}
+
+func cmdPreset(t *target, args []string, r *schema.Result) error {
+	if err := wantArgs(args, 1); err != nil {
+		return err
+	}
+	p := t.cfg.Preset(args[0])
+	if p == nil {
+		return usagef("no preset named %q in %s", args[0], t.cfg.Path())
+	}
+	res, err := preset.Run(t.ctx, p, t.lookup, t.cfg.VerifySwitch(), schema.SourceCLI)
+	r.Preset = res
+	return err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/control"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+)
+
+// owner is what the running instance offers to forwarded commands.
+type owner struct {
+	cfg    *config.Config
+	device func(name string) *device.Device // "" = the first switch
+	show   func() error
+	reload func() error
+}
+
+// claimInstance takes the control socket and serves o on it. It returns
+// false if another instance already owns it; other failures are logged and
+// the caller runs without a control socket.
+func claimInstance(o owner) (srv *control.Server, ok bool) {
+	srv, err := control.Listen()
+	switch {
+	case errors.Is(err, control.ErrRunning):
+		return nil, false
+	case err != nil:
+		log.Printf("[control] %v; other invocations will not be forwarded here", err)
+		return nil, true
+	}
+	go srv.Serve(o.handle)
+	return srv, true
+}
+
+func (o owner) handle(ctx context.Context, req control.Request, r *schema.Result) {
+	switch req.Command {
+	case control.CmdShow:
+		record(r, o.show())
+		return
+	case control.CmdReload:
+		record(r, o.reload())
+		return
+	}
+	cmd, ok := cliCommands[req.Command]
+	if !ok {
+		record(r, usagef("unknown command %q", req.Command))
+		return
+	}
+	d := o.device(req.Device)
+	if d == nil {
+		record(r, usagef("no switch named %q in %s", req.Device, o.cfg.Path()))
+		return
+	}
+	lookup := func(name string) *device.Device {
+		if name == "" {
+			return d
+		}
+		return o.device(name)
+	}
+	dc := d.Config()
+	r.Device, r.Target = dc.Name, dc.Target()
+	record(r, cmd.run(&target{ctx: ctx, cfg: o.cfg, dc: dc, dev: d, lookup: lookup}, req.Args, r))
+}
+
+// runControl sends show or reload to the running instance.
+func runControl(name string) int {
+	r, err := control.Send(context.Background(), control.Request{Command: name})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return exitFailed
+	}
+	return emit("text", r, nil)
+}
@@ -1,31 +1,59 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 
-	"github.com/SiirRandall/tesmart-ui/internal/client"
 	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/control"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
 	"github.com/SiirRandall/tesmart-ui/internal/ui"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch name := os.Args[1]; name {
+		case "simulate":
+			os.Exit(runSimulate(os.Args[2:]))
+		case "serve":
+			os.Exit(runServe(os.Args[2:]))
+		case control.CmdShow, control.CmdReload:
+			os.Exit(runControl(name))
+		case "help", "-h", "-help", "--help":
+			printUsage()
+			os.Exit(exitOK)
+		default:
+			if cmd, ok := cliCommands[name]; ok {
+				os.Exit(runCLI(name, cmd, os.Args[2:]))
+			}
+		}
+	}
+
 	cfg, err := config.Load()
 	if err != nil {
 		fmt.Println("Config error:", err)
 		os.Exit(1)
 	}
 
-	cli := client.New(cfg.IP, cfg.Port,
-		cfg.GetTimeout(), cfg.SetTimeout())
-
-	/*app := ui.NewAppUI(cfg, cli)
-
-	// 🔽 Add just this one line to enable the system tray (tray menu + close-to-tray)
-	app.EnableSystemTray()
+	devs := make([]*device.Device, 0, len(cfg.Devices))
+	for _, dc := range cfg.Devices {
+		devs = append(devs, device.New(dc, cfg.SwitchSuppress()))
+	}
 
-	app.Run()*/
-	app := ui.NewAppUI(cfg, cli)
+	app := ui.NewAppUI(cfg, devs)
+	srv, ok := claimInstance(owner{cfg: cfg, device: app.Device, show: app.ShowWindow, reload: app.ReloadConfig})
+	if !ok {
+		// Already running: bring that window up instead of polling twice.
+		if _, err := control.Send(context.Background(), control.Request{Command: control.CmdShow}); err != nil {
+			fmt.Println("Another instance is running but did not answer:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if srv != nil {
+		defer srv.Close()
+	}
 	app.EnableSystemTray()
 	app.Run()
 }
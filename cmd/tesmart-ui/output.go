@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+
+	"gopkg.in/yaml.v3"
+)
+
+// emitters write a result in one of the -output formats.
+var emitters = map[string]func(w io.Writer, r *schema.Result) error{
+	"text": emitText,
+	"json": emitJSON,
+	"yaml": emitYAML,
+}
+
+func emitJSON(w io.Writer, r *schema.Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func emitYAML(w io.Writer, r *schema.Result) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(r); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// emitText prints the human-readable form; errors go to stderr.
+func emitText(w io.Writer, r *schema.Result) error {
+	if p := r.Preset; p != nil {
+		// Steps are reported even when some failed.
+		for i, s := range p.Steps {
+			what := s.Action + " " + s.Value
+			if s.Action == "" {
+				what = fmt.Sprintf("step %d", i+1)
+			}
+			status := "ok"
+			if s.Error != nil {
+				status = "failed: " + s.Error.Message
+			}
+			if _, err := fmt.Fprintf(w, "%s: %s: %s\n", s.Device, what, status); err != nil {
+				return err
+			}
+		}
+	}
+	if e := r.Error; e != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", r.Command, e.Message)
+		if e.Hint != "" {
+			fmt.Fprintf(os.Stderr, "hint: %s\n", e.Hint)
+		}
+		return nil
+	}
+	var err error
+	switch {
+	case r.Status != nil:
+		a := r.Status.Active
+		_, err = fmt.Fprintf(w, "%s: input %d (%s)\n", r.Device, a.Port, a.Name)
+	case r.Switch != nil:
+		a := r.Switch.Active
+		note := ""
+		switch r.Switch.Result {
+		case schema.SwitchVerified:
+			note = ", verified"
+		case schema.SwitchUnverified:
+			note = ", not yet confirmed by the switch"
+		}
+		_, err = fmt.Fprintf(w, "%s: switched to input %d (%s)%s\n", r.Device, a.Port, a.Name, note)
+	case r.Ping != nil:
+		_, err = fmt.Fprintf(w, "%s: OK in %.1f ms\n", r.Device, r.Ping.LatencyMs)
+	case r.Setting != nil:
+		_, err = fmt.Fprintf(w, "%s: %s %s\n", r.Device, r.Setting.Name, r.Setting.Value)
+	case r.NetConfig != nil:
+		n := r.NetConfig
+		_, err = fmt.Fprintf(w, "ip:   %s\nport: %d\nmask: %s\ngw:   %s\n", n.IP, n.Port, n.Mask, n.Gateway)
+		if err == nil && n.Applied {
+			_, err = fmt.Fprintln(w, "Power-cycle the switch for the new settings to take effect.")
+		}
+	case r.Raw != nil:
+		_, err = fmt.Fprintln(w, r.Raw.Reply)
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/control"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+	"github.com/SiirRandall/tesmart-ui/internal/events"
+	"github.com/SiirRandall/tesmart-ui/internal/history"
+	"github.com/SiirRandall/tesmart-ui/internal/hooks"
+	"github.com/SiirRandall/tesmart-ui/internal/metrics"
+	"github.com/SiirRandall/tesmart-ui/internal/mqtt"
+	"github.com/SiirRandall/tesmart-ui/internal/schedule"
+	"github.com/SiirRandall/tesmart-ui/internal/server"
+)
+
+// runServe polls the configured switches without a window and serves the
+// HTTP API until interrupted.
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listen := fs.String("listen", "127.0.0.1:8080", "address for the HTTP API (use 0.0.0.0:8080 to allow other hosts)")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "config error:", err)
+		return exitUsage
+	}
+	bus := events.NewBus(256)
+	devs := make([]*device.Device, 0, len(cfg.Devices))
+	for _, dc := range cfg.Devices {
+		d := device.New(dc, cfg.SwitchSuppress())
+		d.Events = bus
+		devs = append(devs, d)
+	}
+
+	lookup := func(name string) *device.Device {
+		for _, d := range devs {
+			if name == "" || d.Name() == name {
+				return d
+			}
+		}
+		return nil
+	}
+
+	ctl, ok := claimInstance(owner{
+		cfg:    cfg,
+		device: lookup,
+		show:   func() error { return errors.New("serve has no window") },
+		reload: func() error { return errors.New("restart serve to reload its config") },
+	})
+	if !ok {
+		fmt.Fprintln(os.Stderr, "serve:", control.ErrRunning)
+		return exitFailed
+	}
+	if ctl != nil {
+		defer ctl.Close()
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "serve:", err)
+		return exitUsage
+	}
+	srv := server.New(cfg, devs, bus)
+	srv.Start()
+	defer srv.Close()
+	rec := history.NewRecorder(cfg.Dir(), bus)
+	rec.Start()
+	defer rec.Close()
+	hk := hooks.New(cfg, bus)
+	hk.Start()
+	defer hk.Close()
+	sc := schedule.New(cfg, lookup)
+	sc.Start()
+	defer sc.Close()
+	if cfg.MQTT.Broker != "" {
+		br := mqtt.New(cfg, devs, bus)
+		br.Start()
+		defer br.Close()
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", srv.Handler())
+	mux.Handle("GET /metrics", metrics.New(devs))
+	hs := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = hs.Shutdown(ctx)
+	}()
+
+	log.Printf("[serve] API on http://%s (%d switch(es))", ln.Addr(), len(devs))
+	if err := hs.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, "serve:", err)
+		return exitFailed
+	}
+	return exitOK
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/simulator"
+)
+
+// runSimulate serves a simulated switch until interrupted.
+func runSimulate(args []string) int {
+	st := simulator.DefaultState()
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	listen := fs.String("listen", "127.0.0.1:5000", "address to listen on")
+	fs.IntVar(&st.Ports, "ports", st.Ports, "number of inputs")
+	fs.IntVar(&st.Active, "active", st.Active, "initial active input")
+	pty := fs.Bool("pty", false, "also serve on a pseudo-terminal, for the serial transport (Linux)")
+	fs.BoolVar(&st.Push, "push", false, "announce front-panel changes to connected clients")
+	press := fs.Duration("press", 0, "select the next input this often, as if from the front panel")
+
+	var f simulator.Faults
+	garbage := fs.String("garbage", "", "hex bytes to prefix every reply with")
+	fs.IntVar(&f.Drop, "drop", 0, "drop this many replies (-1 = all)")
+	fs.IntVar(&f.Refuse, "refuse", 0, "reset this many connections on accept (-1 = all)")
+	fs.BoolVar(&f.Split, "split", false, "send replies one byte per segment")
+	fs.IntVar(&f.NULPad, "nulpad", 0, "append this many NUL bytes to replies")
+	fs.DurationVar(&f.Delay, "delay", 0, "delay every reply")
+	fs.BoolVar(&f.Stale, "stale", false, "precede status replies with the previous status frame")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *garbage != "" {
+		b, err := hex.DecodeString(strings.ReplaceAll(*garbage, " ", ""))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "simulate: invalid -garbage:", err)
+			return 2
+		}
+		f.Garbage = b
+	}
+
+	dev := simulator.New(st)
+	dev.SetFaults(f)
+	if err := dev.Listen(*listen); err != nil {
+		fmt.Fprintln(os.Stderr, "simulate:", err)
+		return 1
+	}
+	log.Printf("[sim] TESmart simulator (%d ports) listening on %s", st.Ports, dev.Addr())
+	if *pty {
+		path, err := dev.ServePTY()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "simulate:", err)
+			_ = dev.Close()
+			return 1
+		}
+		log.Printf("[sim] serial port at %s", path)
+	}
+
+	if *press > 0 {
+		go func() {
+			for range time.Tick(*press) {
+				s := dev.State()
+				next := s.Active%s.Ports + 1
+				_ = dev.SetActive(next)
+				log.Printf("[sim] front panel: input %d", next)
+			}
+		}()
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+	_ = dev.Close()
+	return 0
+}
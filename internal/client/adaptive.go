@@ -0,0 +1,143 @@
+package client
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/protocol"
+)
+
+// With adaptive timeouts the get/set deadlines follow the measured round
+// trips: twice their 95th percentile plus some headroom, within the
+// configured bounds. Until enough round trips are measured, the fixed
+// timeouts apply.
+const (
+	rttWindow      = 64 // round trips remembered per kind
+	rttMinSamples  = 8  // replies needed before the deadline adapts
+	rttQuantile    = 0.95
+	rttHeadroom    = 50 * time.Millisecond
+	rttMaxTimeouts = 4 // timeouts remembered at once: enough to lift the 95th percentile
+)
+
+// Timeouts describes the deadlines in effect and what they were learned from.
+type Timeouts struct {
+	Get, Set               time.Duration
+	Adaptive               bool
+	GetRTT, SetRTT         time.Duration // 95th percentile; 0 until measured
+	GetSamples, SetSamples int
+}
+
+type bounds struct{ min, max time.Duration }
+
+type sample struct {
+	d       time.Duration
+	timeout bool
+}
+
+// rtt is a ring of recent round-trip times.
+type rtt struct {
+	mu       sync.Mutex
+	samples  []sample
+	next     int
+	timeouts int // samples in the ring that are timeouts
+}
+
+// add records a round trip, or a timeout after d. Timeouts beyond
+// rttMaxTimeouts are dropped until replies push the older ones out.
+func (r *rtt) add(d time.Duration, timeout bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if timeout && r.timeouts >= rttMaxTimeouts {
+		return
+	}
+	s := sample{d: d, timeout: timeout}
+	if len(r.samples) < rttWindow {
+		r.samples = append(r.samples, s)
+	} else {
+		if r.samples[r.next].timeout {
+			r.timeouts--
+		}
+		r.samples[r.next] = s
+		r.next = (r.next + 1) % rttWindow
+	}
+	if timeout {
+		r.timeouts++
+	}
+}
+
+func (r *rtt) reset() {
+	r.mu.Lock()
+	r.samples, r.next, r.timeouts = nil, 0, 0
+	r.mu.Unlock()
+}
+
+// quantile returns the rttQuantile of the samples and how many replies
+// there are among them.
+func (r *rtt) quantile() (time.Duration, int) {
+	r.mu.Lock()
+	s := make([]time.Duration, len(r.samples))
+	for i, x := range r.samples {
+		s[i] = x.d
+	}
+	replies := len(s) - r.timeouts
+	r.mu.Unlock()
+	if len(s) == 0 {
+		return 0, 0
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	i := int(rttQuantile*float64(len(s))+0.5) - 1
+	return s[max(i, 0)], replies
+}
+
+// SetAdaptive turns adaptive timeouts on or off; min and max bound the
+// learned deadlines.
+func (c *Client) SetAdaptive(on bool, min, max time.Duration) {
+	if !on {
+		c.adaptive.Store(nil)
+		return
+	}
+	c.adaptive.Store(&bounds{min: min, max: max})
+}
+
+// Timeouts reports the current deadlines and round-trip measurements.
+func (c *Client) Timeouts() Timeouts {
+	t := Timeouts{Get: c.getTimeout(), Set: c.setTimeout(), Adaptive: c.adaptive.Load() != nil}
+	t.GetRTT, t.GetSamples = c.getRTT.quantile()
+	t.SetRTT, t.SetSamples = c.setRTT.quantile()
+	return t
+}
+
+func (c *Client) getTimeout() time.Duration { return c.deadline(c.getTO, &c.getRTT) }
+
+// Set commands whose replies come too late are never measured, so they
+// fall back to the status queries' round trips.
+func (c *Client) setTimeout() time.Duration { return c.deadline(c.setTO, &c.setRTT, &c.getRTT) }
+
+// deadline derives a deadline from the first of rtts with enough samples.
+func (c *Client) deadline(fixed time.Duration, rtts ...*rtt) time.Duration {
+	b := c.adaptive.Load()
+	if b == nil {
+		return fixed
+	}
+	d := fixed
+	for _, r := range rtts {
+		if q, n := r.quantile(); n >= rttMinSamples {
+			d = 2*q + rttHeadroom
+			break
+		}
+	}
+	return min(max(d, b.min), b.max)
+}
+
+// measure records a reply to cmd that took d, or a timeout after d. A few
+// status-query timeouts are kept so that a deadline that is too tight grows,
+// but not so many that an outage drives it to the maximum; set commands are
+// not always answered, so only replies count for them.
+func (c *Client) measure(cmd protocol.Command, d time.Duration, replied bool) {
+	if _, ok := cmd.(protocol.QueryActive); ok {
+		c.getRTT.add(d, !replied)
+	} else if replied {
+		c.setRTT.add(d, false)
+	}
+}
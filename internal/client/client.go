@@ -2,14 +2,17 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
 	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/protocol"
 )
 
 type KVMNetConfig struct {
@@ -20,74 +23,390 @@ type KVMNetConfig struct {
 }
 
 type Client struct {
-	addr  string
-	mu    sync.Mutex
+	tr    Transport
+	mu    chan struct{} // 1-slot semaphore so waiters can give up; see lock
 	getTO time.Duration
 	setTO time.Duration
+
+	ports     int  // highest valid input number
+	zeroBased bool // try the 0-based 0x11 switch command before 0x01
+
+	persist   bool // share one long-lived connection between commands
+	keepAlive time.Duration
+	idleTO    time.Duration
+	conn      Conn // persistent session; nil when not connected
+	idleTimer *time.Timer
+	lastUsed  time.Time
+
+	listener   *Listener     // nil = not listening
+	stopListen chan struct{} // closed to stop the listener goroutine
+	session    chan struct{} // signalled when a persistent session opens
+	reading    atomic.Pointer[Conn]
+	waiting    atomic.Int32     // callers queued in lock
+	live       atomic.Bool      // the listener has a session to read
+	between    protocol.Decoder // frames on the session between commands
+	held       []status         // drained status frames not yet handed to the listener
+	late       int              // unanswered commands whose reply may still arrive
+	lateUntil  time.Time
+
+	stats atomic.Pointer[Stats]
+
+	adaptive       atomic.Pointer[bounds] // nil = fixed timeouts
+	getRTT, setRTT rtt
+}
+
+// Stats receives measurements of the client's calls, e.g. for metrics. Nil
+// funcs are skipped. They run on the calling goroutine and must not block.
+type Stats struct {
+	GetActiveInput func(took time.Duration, err error)
+	SetInput       func(took time.Duration, err error)
+	Retry          func(kind string) // one of the Retry* kinds
+}
+
+// Retries reported through Stats.Retry.
+const (
+	RetryGetActive   = "get_active_second_attempt" // first reply had no status frame
+	RetrySetFallback = "set_input_fallback"        // first switch command failed; other encoding tried
+)
+
+// SetStats installs s, replacing any previous Stats.
+func (c *Client) SetStats(s Stats) { c.stats.Store(&s) }
+
+func (c *Client) observe() Stats {
+	if s := c.stats.Load(); s != nil {
+		return *s
+	}
+	return Stats{}
 }
 
 func New(ip string, port int, getTO, setTO time.Duration) *Client {
 	return &Client{
-		addr:  net.JoinHostPort(ip, strconv.Itoa(port)),
-		getTO: getTO,
-		setTO: setTO,
+		tr:      TCP{Addr: net.JoinHostPort(ip, strconv.Itoa(port))},
+		mu:      make(chan struct{}, 1),
+		session: make(chan struct{}, 1),
+		getTO:   getTO,
+		setTO:   setTO,
+		ports:   16,
 	}
 }
 
 func (c *Client) SetTarget(ip string, port int, getTO, setTO time.Duration) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.addr = net.JoinHostPort(ip, strconv.Itoa(port))
+	c.SetTransport(TCP{Addr: net.JoinHostPort(ip, strconv.Itoa(port)), KeepAlive: c.keepAlive}, getTO, setTO)
+}
+
+// SetTransport points the client at tr, e.g. a Serial port instead of TCP.
+func (c *Client) SetTransport(tr Transport, getTO, setTO time.Duration) {
+	c.acquire()
+	defer c.unlock()
+	if t, ok := tr.(TCP); ok {
+		t.KeepAlive = c.keepAlive
+		tr = t
+	}
+	if tr.String() != c.tr.String() {
+		c.closeSession()
+		c.getRTT.reset()
+		c.setRTT.reset()
+	}
+	c.tr = tr
 	c.getTO = getTO
 	c.setTO = setTO
 }
 
-/* Binary protocol: input/status */
+// Target describes where the client sends commands.
+func (c *Client) Target() string {
+	c.acquire()
+	defer c.unlock()
+	return c.tr.String()
+}
+
+// SetProfile tells the client how many inputs the switch has and whether its
+// firmware prefers the 0-based switch command.
+func (c *Client) SetProfile(ports int, zeroBasedSwitch bool) {
+	c.acquire()
+	defer c.unlock()
+	c.ports = ports
+	c.zeroBased = zeroBasedSwitch
+}
+
+// profile reads what SetProfile set, both from the same profile.
+func (c *Client) profile(ctx context.Context) (ports int, zeroBased bool, err error) {
+	if err := c.lock(ctx); err != nil {
+		return 0, false, err
+	}
+	defer c.unlock()
+	return c.ports, c.zeroBased, nil
+}
+
+// SetSession switches between dialing per command (the default) and keeping
+// one persistent connection that is redialed when it breaks. keepAlive is the
+// TCP keepalive period (0 = OS default); idle closes an unused persistent
+// connection after that long (0 = never).
+func (c *Client) SetSession(persist bool, keepAlive, idle time.Duration) {
+	c.acquire()
+	defer c.unlock()
+	if persist != c.persist || keepAlive != c.keepAlive {
+		c.closeSession()
+	}
+	if t, ok := c.tr.(TCP); ok {
+		t.KeepAlive = keepAlive
+		c.tr = t
+	}
+	c.persist = persist
+	c.keepAlive = keepAlive
+	c.idleTO = idle
+}
+
+// Close tears down the persistent connection, if any. The client stays usable
+// and will reconnect on the next command.
+func (c *Client) Close() error {
+	c.acquire()
+	defer c.unlock()
+	c.closeSession()
+	return nil
+}
+
+// lock acquires the client for one exchange. It gives up when ctx is done, so
+// a command queued behind a hung poll can be abandoned. A listener waiting
+// for pushed frames is interrupted rather than waited for.
+func (c *Client) lock(ctx context.Context) error {
+	c.waiting.Add(1)
+	defer c.waiting.Add(-1)
+	c.interrupt()
+	select {
+	case c.mu <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-func findFrames(buf []byte) [][]byte {
-	var frames [][]byte
-	for i := 0; i+5 < len(buf); i++ {
-		if buf[i] == 0xAA && buf[i+1] == 0xBB && buf[i+2] == 0x03 && buf[i+5] == 0xEE {
-			frames = append(frames, buf[i:i+6])
-			i += 4
+// acquire is lock for callers that cannot give up.
+func (c *Client) acquire() { _ = c.lock(context.Background()) }
+
+func (c *Client) unlock() { <-c.mu }
+
+/* Connection handling (caller holds c.mu) */
+
+func (c *Client) closeSession() {
+	c.between.Reset()
+	c.late = 0
+	if c.idleTimer != nil {
+		c.idleTimer.Stop()
+		c.idleTimer = nil
+	}
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// open returns a connection for one exchange; reused reports whether it is an
+// existing persistent session rather than a fresh dial.
+func (c *Client) open(ctx context.Context, timeout time.Duration) (conn Conn, reused bool, err error) {
+	if c.persist && c.conn != nil {
+		if c.idleTimer != nil {
+			c.idleTimer.Stop()
+		}
+		return c.conn, true, nil
+	}
+	conn, err = c.tr.Open(ctx, timeout)
+	if err != nil {
+		return nil, false, err
+	}
+	if c.persist {
+		c.conn = conn
+		select {
+		case c.session <- struct{}{}:
+		default:
 		}
 	}
-	return frames
+	return conn, false, nil
 }
 
-func (c *Client) txrx(cmd, arg byte, totalDeadline time.Duration) ([]byte, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// done finishes an exchange. Per-command connections are closed; a persistent
+// session is kept (and its idle timer re-armed) unless the exchange broke it.
+func (c *Client) done(conn Conn, broken bool) {
+	if conn != c.conn {
+		_ = conn.Close()
+		return
+	}
+	if broken {
+		c.closeSession()
+		return
+	}
+	c.lastUsed = time.Now()
+	if c.idleTO > 0 && c.listener == nil {
+		c.idleTimer = time.AfterFunc(c.idleTO, func() {
+			c.acquire()
+			defer c.unlock()
+			if c.conn == conn && time.Since(c.lastUsed) >= c.idleTO {
+				c.closeSession()
+			}
+		})
+	}
+}
 
-	d := net.Dialer{Timeout: totalDeadline}
-	conn, err := d.Dial("tcp", c.addr)
+// send opens a connection and writes payload. A reused session that turns out
+// to be dead (peer closed it, write fails) is replaced by one fresh dial.
+func (c *Client) send(ctx context.Context, payload []byte, timeout time.Duration) (Conn, error) {
+	conn, reused, err := c.open(ctx, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if reused && c.drain(conn) != nil {
+		c.done(conn, true)
+		if conn, _, err = c.open(ctx, timeout); err != nil {
+			return nil, err
+		}
+		reused = false
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(timeout))
+	_, err = conn.Write(payload)
+	if err != nil && reused {
+		c.done(conn, true)
+		if conn, _, err = c.open(ctx, timeout); err != nil {
+			return nil, err
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(timeout))
+		_, err = conn.Write(payload)
+	}
 	if err != nil {
+		c.done(conn, true)
 		return nil, err
 	}
-	defer conn.Close()
+	return conn, nil
+}
+
+// drain reads what is left on a reused connection (late replies to earlier
+// commands, frames the switch pushed) so it is not mistaken for the answer
+// to the next one. Status frames among it are kept for the listener.
+// It returns an error only if the connection is no longer usable.
+func (c *Client) drain(conn Conn) error {
+	tmp := make([]byte, 256)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Millisecond))
+		n, err := conn.Read(tmp)
+		if c.listener != nil {
+			c.held = append(c.held, c.classify(c.between.Feed(tmp[:n]))...)
+		}
+		if err != nil {
+			if isTimeout(err) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// lateReplies is how long after an unanswered command a status frame on the
+// session is taken for its reply rather than for a push.
+const lateReplies = 2 * time.Second
+
+// status is a status frame read between commands.
+type status struct {
+	port  int
+	reply bool // a late reply to one of our commands
+}
+
+// classify picks the status frames out of frames and tells late replies
+// from pushes: a frame is pushed only when no command awaits its reply.
+func (c *Client) classify(frames []protocol.Frame) []status {
+	var out []status
+	for _, f := range frames {
+		st, ok := f.Status()
+		if !ok {
+			continue
+		}
+		reply := c.late > 0 && time.Now().Before(c.lateUntil)
+		if reply {
+			c.late--
+		} else {
+			c.late = 0
+		}
+		out = append(out, status{port: st.Active, reply: reply})
+	}
+	return out
+}
+
+// unanswered notes a command whose reply did not come in time. Only queries
+// and switch commands are answered with a status frame.
+func (c *Client) unanswered(cmd protocol.Command) {
+	switch cmd.(type) {
+	case protocol.QueryActive, protocol.SwitchInput:
+		c.late++
+		c.lateUntil = time.Now().Add(lateReplies)
+	}
+}
+
+// watch closes conn if ctx is done mid-exchange, which unblocks any pending
+// read or write. The returned func detaches the watcher.
+func watch(ctx context.Context, conn Conn) func() bool {
+	return context.AfterFunc(ctx, func() { _ = conn.Close() })
+}
+
+// abortErr reports ctx's error in place of err when the exchange failed
+// because it was cancelled.
+func abortErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
 
-	frame := []byte{0xAA, 0xBB, 0x03, cmd, arg, 0xEE}
-	if _, err := conn.Write(frame); err != nil {
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+/* Binary protocol: input/status */
+
+// txrx sends cmd and collects bytes until a complete frame arrives or the
+// deadline passes.
+func (c *Client) txrx(ctx context.Context, cmd protocol.Command, totalDeadline time.Duration) ([]byte, error) {
+	if err := c.lock(ctx); err != nil {
 		return nil, err
 	}
+	defer c.unlock()
+
+	conn, err := c.send(ctx, protocol.Encode(cmd), totalDeadline)
+	if err != nil {
+		return nil, abortErr(ctx, err)
+	}
+	broken := false
+	defer func() { c.done(conn, broken) }()
+	defer watch(ctx, conn)()
 
-	deadline := time.Now().Add(totalDeadline)
+	sent := time.Now()
+	deadline := sent.Add(totalDeadline)
 	var buf []byte
+	var dec protocol.Decoder
 	tmp := make([]byte, 256)
 
 	for {
 		if time.Now().After(deadline) {
+			c.measure(cmd, totalDeadline, false)
+			if conn == c.conn {
+				c.unanswered(cmd)
+			}
 			return buf, nil
 		}
 		_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
 		n, err := conn.Read(tmp)
 		if n > 0 {
 			buf = append(buf, tmp[:n]...)
-			if len(findFrames(buf)) > 0 {
+			if len(dec.Feed(tmp[:n])) > 0 {
+				c.measure(cmd, time.Since(sent), true)
 				return buf, nil
 			}
 		}
 		if err != nil {
+			if !isTimeout(err) {
+				broken = true
+				if len(buf) == 0 || ctx.Err() != nil {
+					return nil, abortErr(ctx, err)
+				}
+				return buf, nil
+			}
 			time.Sleep(15 * time.Millisecond)
 		}
 		if len(buf) > 4096 {
@@ -96,68 +415,128 @@ func (c *Client) txrx(cmd, arg byte, totalDeadline time.Duration) ([]byte, error
 	}
 }
 
-func scanActiveFrom(buf []byte) (int, bool) {
-	if frames := findFrames(buf); len(frames) > 0 {
-		for _, f := range frames {
-			if len(f) == 6 && f[3] == 0x11 {
-				return int(f[4]) + 1, true
-			}
-		}
-	}
-	for i := 0; i+4 < len(buf); i++ {
-		if buf[i] == 0xAA && buf[i+1] == 0xBB && buf[i+2] == 0x03 && buf[i+3] == 0x11 {
-			return int(buf[i+4]) + 1, true
-		}
+func (c *Client) GetActiveInput() (int, error) {
+	return c.GetActiveInputContext(context.Background())
+}
+
+func (c *Client) GetActiveInputContext(ctx context.Context) (port int, err error) {
+	st, start := c.observe(), time.Now()
+	if st.GetActiveInput != nil {
+		defer func() { st.GetActiveInput(time.Since(start), err) }()
 	}
-	return 0, false
+	return c.getActiveInput(ctx, st)
 }
 
-func (c *Client) GetActiveInput() (int, error) {
-	resp, err := c.txrx(0x10, 0x00, c.getTO)
+func (c *Client) getActiveInput(ctx context.Context, stats Stats) (int, error) {
+	const op = "get active input"
+	resp, err := c.txrx(ctx, protocol.QueryActive{}, c.getTimeout())
+	if err != nil {
+		return 0, wrap(op, err)
+	}
+	if st, ok := protocol.ScanStatus(resp); ok {
+		return st.Active, nil
+	}
+	// A reply that shows up after the deadline must not be read as the answer
+	// to the retry, so start the retry on a fresh persistent connection.
+	_ = c.Close()
+	if stats.Retry != nil {
+		stats.Retry(RetryGetActive)
+	}
+	resp2, err := c.txrx(ctx, protocol.QueryActive{}, c.getTimeout())
+	if ctx.Err() != nil {
+		return 0, wrap(op, ctx.Err())
+	}
 	if err != nil {
-		return 0, err
+		return 0, wrap(op, err)
+	}
+	if st, ok := protocol.ScanStatus(resp2); ok {
+		return st.Active, nil
 	}
-	if p, ok := scanActiveFrom(resp); ok {
-		return p, nil
+	_ = c.Close()
+	if len(resp) == 0 {
+		resp = resp2
 	}
-	resp2, _ := c.txrx(0x10, 0x00, c.getTO)
-	if p, ok := scanActiveFrom(resp2); ok {
-		return p, nil
+	if len(resp) == 0 {
+		return 0, &Error{Op: op, Kind: ErrNoReply}
 	}
-	return 0, fmt.Errorf("no active-input reply in %s", strings.ToUpper(hex.EncodeToString(resp)))
+	return 0, &Error{Op: op, Kind: ErrMalformedFrame, Raw: resp}
 }
 
-func (c *Client) SetInput(n int) error {
-	if n < 1 || n > 16 {
-		return fmt.Errorf("input out of range: %d", n)
+func (c *Client) SetInput(n int) error { return c.SetInputContext(context.Background(), n) }
+
+func (c *Client) SetInputContext(ctx context.Context, n int) (err error) {
+	const op = "set input"
+	st, start := c.observe(), time.Now()
+	if st.SetInput != nil {
+		defer func() { st.SetInput(time.Since(start), err) }()
+	}
+	ports, zeroBased, err := c.profile(ctx)
+	if err != nil {
+		return wrap(op, err)
+	}
+	if n < 1 || n > ports {
+		return &Error{Op: op, Kind: ErrInputRange, Err: fmt.Errorf("%d not in 1..%d", n, ports)}
+	}
+	first, second := protocol.SwitchInput{Input: n}, protocol.SwitchInput{Input: n, ZeroBased: true}
+	if zeroBased {
+		first, second = second, first
 	}
-	if _, err := c.txrx(0x01, byte(n), c.setTO); err == nil {
+	_, err = c.txrx(ctx, first, c.setTimeout())
+	switch {
+	case err == nil:
 		return nil
+	case ctx.Err() != nil:
+		return wrap(op, ctx.Err())
 	}
-	_, err := c.txrx(0x11, byte(n-1), c.setTO)
-	return err
+	if st.Retry != nil {
+		st.Retry(RetrySetFallback)
+	}
+	_, err = c.txrx(ctx, second, c.setTimeout())
+	return wrap(op, err)
 }
 
 func (c *Client) SetBuzzer(enabled bool) error {
-	var v byte
-	if enabled {
-		v = 0x01
-	}
-	_, err := c.txrx(0x02, v, c.setTO)
-	return err
+	return c.SetBuzzerContext(context.Background(), enabled)
+}
+
+func (c *Client) SetBuzzerContext(ctx context.Context, enabled bool) error {
+	_, err := c.txrx(ctx, protocol.Buzzer{On: enabled}, c.setTimeout())
+	return wrap("set buzzer", err)
+}
+
+func (c *Client) SetLEDTimeoutOff() error { return c.SetLEDTimeoutOffContext(context.Background()) }
+func (c *Client) SetLEDTimeout10s() error { return c.SetLEDTimeout10sContext(context.Background()) }
+func (c *Client) SetLEDTimeout30s() error { return c.SetLEDTimeout30sContext(context.Background()) }
+
+func (c *Client) SetLEDTimeoutOffContext(ctx context.Context) error {
+	return c.SetLEDTimeoutContext(ctx, protocol.LEDAlwaysOn)
+}
+func (c *Client) SetLEDTimeout10sContext(ctx context.Context) error {
+	return c.SetLEDTimeoutContext(ctx, protocol.LED10s)
+}
+func (c *Client) SetLEDTimeout30sContext(ctx context.Context) error {
+	return c.SetLEDTimeoutContext(ctx, protocol.LED30s)
 }
-func (c *Client) SetLEDTimeoutOff() error { _, err := c.txrx(0x03, 0x00, c.setTO); return err }
-func (c *Client) SetLEDTimeout10s() error { _, err := c.txrx(0x03, 0x0A, c.setTO); return err }
-func (c *Client) SetLEDTimeout30s() error { _, err := c.txrx(0x03, 0x1E, c.setTO); return err }
 
-func (c *Client) Ping() error {
-	_, err := c.GetActiveInput()
+func (c *Client) SetLEDTimeoutContext(ctx context.Context, t protocol.LEDTimeout) error {
+	_, err := c.txrx(ctx, t, c.setTimeout())
+	return wrap("set LED timeout", err)
+}
+
+func (c *Client) Ping() error { return c.PingContext(context.Background()) }
+
+func (c *Client) PingContext(ctx context.Context) error {
+	_, err := c.GetActiveInputContext(ctx)
 	return err
 }
 
 /* Raw hex sender */
 
 func (c *Client) RawHexSend(hexstr string, deadline time.Duration) (string, error) {
+	return c.RawHexSendContext(context.Background(), hexstr, deadline)
+}
+
+func (c *Client) RawHexSendContext(ctx context.Context, hexstr string, deadline time.Duration) (string, error) {
 	hexstr = strings.ReplaceAll(hexstr, " ", "")
 	if hexstr == "" {
 		return "", errors.New("empty hex")
@@ -167,19 +546,18 @@ func (c *Client) RawHexSend(hexstr string, deadline time.Duration) (string, erro
 		return "", fmt.Errorf("invalid hex: %w", err)
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	d := net.Dialer{Timeout: deadline}
-	conn, err := d.Dial("tcp", c.addr)
-	if err != nil {
+	if err := c.lock(ctx); err != nil {
 		return "", err
 	}
-	defer conn.Close()
+	defer c.unlock()
 
-	if _, err := conn.Write(payload); err != nil {
-		return "", err
+	conn, err := c.send(ctx, payload, deadline)
+	if err != nil {
+		return "", wrap("raw send", abortErr(ctx, err))
 	}
+	broken := false
+	defer func() { c.done(conn, broken) }()
+	defer watch(ctx, conn)()
 
 	var buf []byte
 	tmp := make([]byte, 256)
@@ -194,6 +572,13 @@ func (c *Client) RawHexSend(hexstr string, deadline time.Duration) (string, erro
 			buf = append(buf, tmp[:n]...)
 		}
 		if er != nil {
+			if !isTimeout(er) {
+				broken = true
+				if ctx.Err() != nil {
+					return "", ctx.Err()
+				}
+				break
+			}
 			time.Sleep(15 * time.Millisecond)
 		}
 		if len(buf) > 4096 {
@@ -205,20 +590,19 @@ func (c *Client) RawHexSend(hexstr string, deadline time.Duration) (string, erro
 
 /* ASCII LAN network config (IP) */
 
-func (c *Client) sendAsciiOnce(pkt string, deadline time.Duration) ([]byte, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	d := net.Dialer{Timeout: deadline}
-	conn, err := d.Dial("tcp", c.addr)
-	if err != nil {
+func (c *Client) sendAsciiOnce(ctx context.Context, pkt string, deadline time.Duration) ([]byte, error) {
+	if err := c.lock(ctx); err != nil {
 		return nil, err
 	}
-	defer conn.Close()
+	defer c.unlock()
 
-	if _, err := conn.Write([]byte(pkt)); err != nil {
-		return nil, err
+	conn, err := c.send(ctx, []byte(pkt), deadline)
+	if err != nil {
+		return nil, abortErr(ctx, err)
 	}
+	broken := false
+	defer func() { c.done(conn, broken) }()
+	defer watch(ctx, conn)()
 
 	_ = conn.SetReadDeadline(time.Now().Add(deadline))
 	var out []byte
@@ -229,6 +613,10 @@ func (c *Client) sendAsciiOnce(pkt string, deadline time.Duration) ([]byte, erro
 			out = append(out, buf[:n]...)
 		}
 		if er != nil {
+			broken = !isTimeout(er)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
 			break
 		}
 		if len(out) > 2048 {
@@ -238,20 +626,19 @@ func (c *Client) sendAsciiOnce(pkt string, deadline time.Duration) ([]byte, erro
 	return out, nil
 }
 
-func (c *Client) sendAsciiUntilTerm(pkt string, deadline time.Duration, term byte) (string, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	d := net.Dialer{Timeout: deadline}
-	conn, err := d.Dial("tcp", c.addr)
-	if err != nil {
+func (c *Client) sendAsciiUntilTerm(ctx context.Context, pkt string, deadline time.Duration, term byte) (string, error) {
+	if err := c.lock(ctx); err != nil {
 		return "", err
 	}
-	defer conn.Close()
+	defer c.unlock()
 
-	if _, err := conn.Write([]byte(pkt)); err != nil {
-		return "", err
+	conn, err := c.send(ctx, []byte(pkt), deadline)
+	if err != nil {
+		return "", abortErr(ctx, err)
 	}
+	broken := false
+	defer func() { c.done(conn, broken) }()
+	defer watch(ctx, conn)()
 
 	end := time.Now().Add(deadline)
 	var out []byte
@@ -269,109 +656,93 @@ func (c *Client) sendAsciiUntilTerm(pkt string, deadline time.Duration, term byt
 			}
 		}
 		if er != nil {
+			if !isTimeout(er) {
+				broken = true
+				if ctx.Err() != nil {
+					return "", ctx.Err()
+				}
+				break
+			}
 			time.Sleep(20 * time.Millisecond)
 		}
 		if len(out) > 2048 {
 			break
 		}
 	}
-	s := strings.ReplaceAll(string(out), "\x00", "")
-	s = strings.ReplaceAll(s, "\r", "")
-	s = strings.ReplaceAll(s, "\n", "")
+	s := protocol.Clean(out)
 	if cut := strings.IndexByte(s, term); cut >= 0 {
 		s = s[:cut+1]
 	}
 	return s, nil
 }
 
-func keepDigitsDots(s string) string {
-	var b strings.Builder
-	for _, r := range s {
-		if (r >= '0' && r <= '9') || r == '.' {
-			b.WriteRune(r)
-		}
-	}
-	return b.String()
-}
-func keepDigits(s string) string {
-	var b strings.Builder
-	for _, r := range s {
-		if r >= '0' && r <= '9' {
-			b.WriteRune(r)
-		}
-	}
-	return b.String()
+func (c *Client) GetNetworkConfigASCII() (KVMNetConfig, error) {
+	return c.GetNetworkConfigASCIIContext(context.Background())
 }
 
-func (c *Client) GetNetworkConfigASCII() (KVMNetConfig, error) {
-	readField := func(q, prefix string) (string, error) {
-		s, err := c.sendAsciiUntilTerm(q, 2*time.Second, ';')
+func (c *Client) GetNetworkConfigASCIIContext(ctx context.Context) (KVMNetConfig, error) {
+	readField := func(f protocol.NetField) (string, error) {
+		q := protocol.Query(f)
+		op := "query " + string(q)
+		s, err := c.sendAsciiUntilTerm(ctx, string(q), 2*time.Second, protocol.ReplyTerm)
+		if err != nil {
+			return "", wrap(op, err)
+		}
+		v, err := protocol.ParseReply(f, []byte(s))
 		if err != nil {
-			return "", err
+			return "", &Error{Op: op, Kind: ErrNoReply}
 		}
-		s = strings.TrimSpace(s)
-		s = strings.TrimSuffix(s, ";")
-		s = strings.TrimPrefix(s, prefix)
-		return s, nil
+		return v, nil
 	}
 
-	ipRaw, err := readField("IP?", "IP:")
+	ipRaw, err := readField(protocol.FieldIP)
 	if err != nil {
 		return KVMNetConfig{}, err
 	}
-	ptRaw, err := readField("PT?", "PT:")
+	ptRaw, err := readField(protocol.FieldPort)
 	if err != nil {
 		return KVMNetConfig{}, err
 	}
-	maskRaw, err := readField("MA?", "MA:")
+	maskRaw, err := readField(protocol.FieldMask)
 	if err != nil {
 		return KVMNetConfig{}, err
 	}
-	gwRaw, err := readField("GW?", "GW:")
+	gwRaw, err := readField(protocol.FieldGateway)
 	if err != nil {
 		return KVMNetConfig{}, err
 	}
 
-	depad := func(s string) string {
-		parts := strings.Split(keepDigitsDots(s), ".")
-		for i := range parts {
-			if n, e := strconv.Atoi(parts[i]); e == nil {
-				parts[i] = strconv.Itoa(n)
-			}
-		}
-		return strings.Join(parts, ".")
-	}
-	ip := depad(ipRaw)
-	mask := depad(maskRaw)
-	gw := depad(gwRaw)
-
-	ptDigits := keepDigits(ptRaw)
-	if ptDigits == "" {
-		return KVMNetConfig{}, fmt.Errorf("bad port reply: %q", ptRaw)
-	}
-	port, err := strconv.Atoi(ptDigits)
-	if err != nil || port <= 0 || port > 65535 {
-		return KVMNetConfig{}, fmt.Errorf("bad port: %v", ptDigits)
+	port, err := protocol.DecodePort(ptRaw)
+	if err != nil {
+		return KVMNetConfig{}, &Error{Op: "query PT?", Kind: ErrUnexpectedReply, Raw: []byte(ptRaw)}
 	}
 
-	return KVMNetConfig{IP: ip, Port: port, Mask: mask, GW: gw}, nil
+	return KVMNetConfig{
+		IP:   protocol.DecodeAddr(ipRaw),
+		Port: port,
+		Mask: protocol.DecodeAddr(maskRaw),
+		GW:   protocol.DecodeAddr(gwRaw),
+	}, nil
 }
 
 func (c *Client) SetNetworkConfigASCII(ip string, port int, mask, gw string) error {
-	seq := []string{
-		fmt.Sprintf("IP:%s;", ip),
-		fmt.Sprintf("PT:%d;", port),
-		fmt.Sprintf("MA:%s;", mask),
-		fmt.Sprintf("GW:%s;", gw),
+	return c.SetNetworkConfigASCIIContext(context.Background(), ip, port, mask, gw)
+}
+
+func (c *Client) SetNetworkConfigASCIIContext(ctx context.Context, ip string, port int, mask, gw string) error {
+	seq := [][]byte{
+		protocol.Set(protocol.FieldIP, ip),
+		protocol.SetPort(port),
+		protocol.Set(protocol.FieldMask, mask),
+		protocol.Set(protocol.FieldGateway, gw),
 	}
 	for _, pkt := range seq {
-		b, err := c.sendAsciiOnce(pkt, 2*time.Second)
+		b, err := c.sendAsciiOnce(ctx, string(pkt), 2*time.Second)
 		if err != nil {
-			return err
+			return wrap("send "+string(pkt), err)
 		}
-		resp := strings.TrimSpace(strings.ReplaceAll(string(b), "\x00", ""))
-		if resp != "" && !strings.Contains(resp, "OK") {
-			return fmt.Errorf("unexpected reply to %q: %q", pkt, resp)
+		if !protocol.IsOK(b) {
+			return &Error{Op: "send " + string(pkt), Kind: ErrUnexpectedReply, Raw: b}
 		}
 	}
 	return nil
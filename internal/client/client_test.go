@@ -0,0 +1,169 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/client"
+	"github.com/SiirRandall/tesmart-ui/internal/simulator"
+)
+
+const (
+	testGetTO = 150 * time.Millisecond
+	testSetTO = 150 * time.Millisecond
+)
+
+// newPair starts a simulator with input 3 active and a client pointed at it.
+func newPair(t *testing.T) (*simulator.Device, *client.Client) {
+	t.Helper()
+	st := simulator.DefaultState()
+	st.Active = 3
+	return newPairWith(t, st)
+}
+
+func newPairWith(t *testing.T, st simulator.State) (*simulator.Device, *client.Client) {
+	t.Helper()
+	sim := simulator.New(st)
+	sim.Logf = func(string, ...any) {}
+	if err := sim.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sim.Close() })
+	addr := sim.Addr().(*net.TCPAddr)
+	cli := client.New(addr.IP.String(), addr.Port, testGetTO, testSetTO)
+	t.Cleanup(func() { _ = cli.Close() })
+	return sim, cli
+}
+
+func TestClientFaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		faults simulator.Faults
+		before func(*simulator.Device, *client.Client) // runs before the faults apply
+		set    int                                     // switch to this input instead of querying
+		want   int                                     // active input reported, or left on the simulator
+		err    error                                   // expected kind; nil = success
+		retry  map[string]int
+	}{
+		{name: "clean", want: 3},
+		{name: "dropped reply", faults: simulator.Faults{Drop: 1}, want: 3,
+			retry: map[string]int{client.RetryGetActive: 1}},
+		{name: "no replies", faults: simulator.Faults{Drop: -1}, err: client.ErrNoReply,
+			retry: map[string]int{client.RetryGetActive: 1}},
+		{name: "split frame", faults: simulator.Faults{Split: true}, want: 3},
+		{name: "garbage prefix", faults: simulator.Faults{Garbage: []byte{0xFF, 0x00, 0xAA}}, want: 3},
+		{name: "NUL padding", faults: simulator.Faults{NULPad: 8}, want: 3},
+		{name: "late reply", faults: simulator.Faults{Delay: 2 * testGetTO}, err: client.ErrNoReply,
+			retry: map[string]int{client.RetryGetActive: 1}},
+		{name: "refused connection", faults: simulator.Faults{Refuse: 1}, err: client.ErrUnreachable},
+		{name: "stale frame", faults: simulator.Faults{Stale: true}, want: 5,
+			before: func(sim *simulator.Device, cli *client.Client) {
+				_, _ = cli.GetActiveInput()
+				_ = sim.SetActive(5)
+			}},
+		{name: "set clean", set: 7, want: 7},
+		{name: "set refused once", faults: simulator.Faults{Refuse: 1}, set: 7, want: 7,
+			retry: map[string]int{client.RetrySetFallback: 1}},
+		{name: "set refused", faults: simulator.Faults{Refuse: -1}, set: 7, want: 3, err: client.ErrUnreachable,
+			retry: map[string]int{client.RetrySetFallback: 1}},
+		{name: "set out of range", set: 17, want: 3, err: client.ErrInputRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim, cli := newPair(t)
+			if tt.before != nil {
+				tt.before(sim, cli)
+			}
+			sim.SetFaults(tt.faults)
+			retries := map[string]int{}
+			cli.SetStats(client.Stats{Retry: func(kind string) { retries[kind]++ }})
+
+			var got int
+			var err error
+			if tt.set != 0 {
+				err = cli.SetInput(tt.set)
+				got = sim.State().Active
+			} else {
+				got, err = cli.GetActiveInput()
+			}
+
+			switch {
+			case tt.err == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.err != nil && !errors.Is(err, tt.err):
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("input = %d, want %d", got, tt.want)
+			}
+			for _, kind := range []string{client.RetryGetActive, client.RetrySetFallback} {
+				if retries[kind] != tt.retry[kind] {
+					t.Errorf("retries[%s] = %d, want %d", kind, retries[kind], tt.retry[kind])
+				}
+			}
+		})
+	}
+}
+
+// The retry's own failure is reported, not a generic "no reply".
+func TestGetActiveRetryFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		onRetry func(sim *simulator.Device, cancel context.CancelFunc)
+		err     error
+	}{
+		{name: "host gone", onRetry: func(sim *simulator.Device, _ context.CancelFunc) { _ = sim.Close() },
+			err: client.ErrUnreachable},
+		{name: "cancelled", onRetry: func(_ *simulator.Device, cancel context.CancelFunc) { cancel() },
+			err: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim, cli := newPair(t)
+			sim.SetFaults(simulator.Faults{Drop: 1})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			cli.SetStats(client.Stats{Retry: func(string) { tt.onRetry(sim, cancel) }})
+			got, err := cli.GetActiveInputContext(ctx)
+			if !errors.Is(err, tt.err) || got != 0 {
+				t.Fatalf("got %d, %v; want 0, %v", got, err, tt.err)
+			}
+		})
+	}
+}
+
+// An outage lifts the learned deadline once at most; a switch that got
+// slower than the deadline still gets a longer one.
+func TestAdaptiveTimeouts(t *testing.T) {
+	sim, cli := newPair(t)
+	cli.SetAdaptive(true, 10*time.Millisecond, 5*time.Second)
+	for range 32 {
+		if _, err := cli.GetActiveInput(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	learned := cli.Timeouts().Get
+
+	sim.SetFaults(simulator.Faults{Drop: -1})
+	for range 6 {
+		if _, err := cli.GetActiveInput(); err == nil {
+			t.Fatal("reply during the outage")
+		}
+	}
+	if got, limit := cli.Timeouts().Get, 2*learned+60*time.Millisecond; got > limit {
+		t.Fatalf("deadline after the outage %v, want at most %v", got, limit)
+	}
+
+	delay := 2 * learned
+	sim.SetFaults(simulator.Faults{Delay: delay})
+	for range 40 {
+		if tm := cli.Timeouts(); tm.GetRTT >= delay && tm.Get > delay {
+			return
+		}
+		_, _ = cli.GetActiveInput()
+	}
+	t.Fatalf("deadline %v, round trips %v; the switch answers after %v", cli.Timeouts().Get, cli.Timeouts().GetRTT, delay)
+}
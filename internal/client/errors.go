@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Failure classes. Every error returned by Client (other than a cancelled or
+// expired context) matches exactly one of these with errors.Is.
+var (
+	ErrUnreachable     = errors.New("device unreachable")
+	ErrTimeout         = errors.New("connection timed out")
+	ErrNoReply         = errors.New("no reply from device")
+	ErrMalformedFrame  = errors.New("malformed frame")
+	ErrUnexpectedReply = errors.New("unexpected reply")
+	ErrInputRange      = errors.New("input out of range")
+	ErrConfig          = errors.New("invalid connection settings")
+)
+
+// Error is the concrete error type returned by Client. Use errors.As to get
+// at the raw reply bytes.
+type Error struct {
+	Op   string // operation that failed, e.g. "get active input"
+	Kind error  // one of the Err* values above
+	Raw  []byte // bytes received from the device, if any
+	Err  error  // underlying cause, e.g. a *net.OpError; may be nil
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Op)
+	b.WriteString(": ")
+	b.WriteString(e.Kind.Error())
+	if len(e.Raw) > 0 {
+		fmt.Fprintf(&b, " (got %s)", strings.ToUpper(hex.EncodeToString(e.Raw)))
+	}
+	if e.Err != nil {
+		b.WriteString(": ")
+		b.WriteString(e.Err.Error())
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// wrap attaches op to err, classifying bare network errors. Context errors
+// and already-classified errors pass through unchanged.
+func wrap(op string, err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	var ce *Error
+	if errors.As(err, &ce) {
+		return err
+	}
+	kind := ErrUnreachable
+	if isTimeout(err) {
+		kind = ErrTimeout
+	}
+	return &Error{Op: op, Kind: kind, Err: err}
+}
+
+// Hint turns an error from Client into a short, user-facing explanation of
+// what is probably wrong.
+func Hint(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return "Cancelled"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrTimeout):
+		return "Connection timed out — switch may be off or firewalled"
+	case errors.Is(err, ErrConfig):
+		var ce *Error
+		if errors.As(err, &ce) && ce.Err != nil {
+			return "Invalid connection settings: " + ce.Err.Error()
+		}
+		return "Invalid connection settings"
+	case errors.Is(err, ErrSerialUnsupported):
+		return "Serial ports are not supported on this platform"
+	case errors.Is(err, ErrUnreachable) && errors.As(err, new(*os.PathError)):
+		return "Serial port unavailable — check the device path and permissions"
+	case errors.Is(err, ErrUnreachable):
+		return "Host down or port closed — check IP/port and network"
+	case errors.Is(err, ErrNoReply):
+		return "Device reachable but not answering"
+	case errors.Is(err, ErrMalformedFrame):
+		return "Device answered with an unrecognised frame"
+	case errors.Is(err, ErrUnexpectedReply):
+		return "Device gave an unexpected reply"
+	case errors.Is(err, ErrInputRange):
+		return "No such input on this switch"
+	}
+	return err.Error()
+}
@@ -0,0 +1,116 @@
+package client
+
+import "time"
+
+// listenSlice bounds each read of the listener, so it notices being stopped.
+const listenSlice = time.Second
+
+// Listener receives frames the switch sends on its own, such as the status
+// some firmware pushes when a front-panel button is pressed. The funcs run
+// on the listener goroutine; nil funcs are skipped.
+type Listener struct {
+	OnStatus func(port int) // the switch reported its active input unprompted
+	OnReply  func(port int) // a reply to a command that had timed out came after all
+	OnDrop   func()         // the session broke between commands
+}
+
+// SetListener starts reading the persistent session between commands and
+// hands the frames found there to l; nil stops it. Without a persistent
+// session there is nothing to read, so the listener waits for one. While
+// listening the session is not closed for being idle.
+func (c *Client) SetListener(l *Listener) {
+	c.acquire()
+	defer c.unlock()
+	if c.stopListen != nil {
+		close(c.stopListen)
+		c.stopListen = nil
+	}
+	c.listener = l
+	c.live.Store(false)
+	if l == nil {
+		return
+	}
+	if c.idleTimer != nil {
+		c.idleTimer.Stop()
+		c.idleTimer = nil
+	}
+	c.stopListen = make(chan struct{})
+	go c.listen(*l, c.stopListen)
+}
+
+// Listening reports whether a listener is reading an open session.
+func (c *Client) Listening() bool { return c.live.Load() }
+
+// listen reads the session whenever no command holds the client. Commands
+// interrupt a pending read through interrupt, and unlock hands the client
+// straight to them.
+func (c *Client) listen(l Listener, stop chan struct{}) {
+	tmp := make([]byte, 256)
+	for {
+		select {
+		case c.mu <- struct{}{}:
+		case <-stop:
+			return
+		}
+		select {
+		case <-stop:
+			c.unlock()
+			return
+		default:
+		}
+		held := c.held
+		c.held = nil
+		if c.conn == nil {
+			c.live.Store(false)
+			c.unlock()
+			l.deliver(held)
+			select {
+			case <-c.session:
+			case <-stop:
+				return
+			}
+			continue
+		}
+		conn := c.conn
+		c.live.Store(true)
+
+		var n int
+		var err error
+		_ = conn.SetReadDeadline(time.Now().Add(listenSlice))
+		c.reading.Store(&conn)
+		if c.waiting.Load() == 0 {
+			n, err = conn.Read(tmp)
+		}
+		c.reading.Store(nil)
+		frames := append(held, c.classify(c.between.Feed(tmp[:n]))...)
+		dropped := err != nil && !isTimeout(err)
+		if dropped {
+			c.closeSession()
+			c.live.Store(false)
+		}
+		c.unlock()
+
+		l.deliver(frames)
+		if dropped && l.OnDrop != nil {
+			l.OnDrop()
+		}
+	}
+}
+
+func (l Listener) deliver(frames []status) {
+	for _, f := range frames {
+		if f.reply && l.OnReply != nil {
+			l.OnReply(f.port)
+		} else if !f.reply && l.OnStatus != nil {
+			l.OnStatus(f.port)
+		}
+	}
+}
+
+// interrupt ends the listener's pending read, if any, so a command need not
+// wait for it to time out.
+func (c *Client) interrupt() {
+	if conn := c.reading.Load(); conn != nil {
+		_ = (*conn).SetReadDeadline(time.Now())
+	}
+}
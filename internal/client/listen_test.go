@@ -0,0 +1,91 @@
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/client"
+	"github.com/SiirRandall/tesmart-ui/internal/simulator"
+)
+
+type heard struct {
+	port  int
+	reply bool
+}
+
+// listening sets up a switch that pushes changes and a persistent session to
+// it, with a listener that reports what it hears on frames. After each frame
+// the listener waits for release before it reads again.
+func listening(t *testing.T) (sim *simulator.Device, cli *client.Client, frames <-chan heard, release chan<- struct{}) {
+	t.Helper()
+	st := simulator.DefaultState()
+	st.Active, st.Push = 3, true
+	sim, cli = newPairWith(t, st)
+	cli.SetSession(true, 0, 0)
+	if _, err := cli.GetActiveInput(); err != nil {
+		t.Fatal(err)
+	}
+	ch, rel := make(chan heard, 8), make(chan struct{})
+	cli.SetListener(&client.Listener{
+		OnStatus: func(port int) { ch <- heard{port, false}; <-rel },
+		OnReply:  func(port int) { ch <- heard{port, true}; <-rel },
+	})
+	t.Cleanup(func() {
+		close(rel)
+		cli.SetListener(nil)
+	})
+	for deadline := time.Now().Add(2 * time.Second); !cli.Listening(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("listener never read the session")
+		}
+	}
+	return sim, cli, ch, rel
+}
+
+func expect(t *testing.T, frames <-chan heard, want heard) {
+	t.Helper()
+	select {
+	case got := <-frames:
+		if got != want {
+			t.Fatalf("heard %+v, want %+v", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("heard nothing, want %+v", want)
+	}
+}
+
+// A reply that comes after its command gave up is not a push.
+func TestListenerLateReply(t *testing.T) {
+	sim, cli, frames, release := listening(t)
+	sim.SetFaults(simulator.Faults{Delay: 2 * testSetTO})
+	if err := cli.SetInput(4); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, frames, heard{4, true})
+	release <- struct{}{}
+
+	sim.SetFaults(simulator.Faults{})
+	if err := sim.SetActive(6); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, frames, heard{6, false})
+}
+
+// A push that is still on the session when the next command goes out
+// reaches the listener all the same.
+func TestListenerDrainedPush(t *testing.T) {
+	sim, cli, frames, release := listening(t)
+	if err := sim.SetActive(5); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, frames, heard{5, false}) // the listener is held up here
+	if err := sim.SetActive(7); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got, err := cli.GetActiveInput(); err != nil || got != 7 {
+		t.Fatalf("got %d, %v; want 7", got, err)
+	}
+	release <- struct{}{}
+	expect(t, frames, heard{7, false})
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Serial reaches the switch over RS-232, directly or through a USB adapter.
+// TESmart units ship at 9600 baud, 8N1.
+type Serial struct {
+	Path     string // e.g. /dev/ttyUSB0
+	Baud     int
+	DataBits int  // 5..8
+	Parity   byte // 'N', 'E' or 'O'
+	StopBits int  // 1 or 2
+}
+
+// ErrSerialUnsupported is returned when opening a serial port on a platform
+// without serial support.
+var ErrSerialUnsupported = errors.New("serial ports are not supported on this platform")
+
+// NewSerial returns a Serial for path with the given baud rate and framing
+// such as "8N1" (empty means 8N1; baud 0 means 9600).
+func NewSerial(path string, baud int, framing string) (Serial, error) {
+	s := Serial{Path: path, Baud: baud, DataBits: 8, Parity: 'N', StopBits: 1}
+	if s.Baud == 0 {
+		s.Baud = 9600
+	}
+	if framing == "" {
+		return s, nil
+	}
+	f := strings.ToUpper(strings.TrimSpace(framing))
+	if len(f) != 3 || f[0] < '5' || f[0] > '8' || strings.IndexByte("NEO", f[1]) < 0 || (f[2] != '1' && f[2] != '2') {
+		return s, fmt.Errorf("invalid serial framing %q (want e.g. 8N1)", framing)
+	}
+	s.DataBits = int(f[0] - '0')
+	s.Parity = f[1]
+	s.StopBits = int(f[2] - '0')
+	return s, nil
+}
+
+func (s Serial) Framing() string {
+	return fmt.Sprintf("%d%c%d", s.DataBits, s.Parity, s.StopBits)
+}
+
+func (s Serial) String() string {
+	return fmt.Sprintf("%s@%d/%s", s.Path, s.Baud, s.Framing())
+}
@@ -0,0 +1,84 @@
+//go:build linux
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var baudRates = map[int]uint32{
+	1200:   unix.B1200,
+	2400:   unix.B2400,
+	4800:   unix.B4800,
+	9600:   unix.B9600,
+	19200:  unix.B19200,
+	38400:  unix.B38400,
+	57600:  unix.B57600,
+	115200: unix.B115200,
+	230400: unix.B230400,
+}
+
+// Open puts the tty in raw mode with the configured framing. The file is
+// opened non-blocking so the runtime poller backs its read/write deadlines,
+// which the frame logic relies on exactly as it does for TCP.
+func (s Serial) Open(ctx context.Context, _ time.Duration) (Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	speed, ok := baudRates[s.Baud]
+	if !ok {
+		return nil, &Error{Op: "open " + s.Path, Kind: ErrConfig, Err: fmt.Errorf("unsupported baud rate %d", s.Baud)}
+	}
+	fd, err := unix.Open(s.Path, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: s.Path, Err: err}
+	}
+	if err := s.configure(fd, speed); err != nil {
+		_ = unix.Close(fd)
+		return nil, &os.PathError{Op: "configure", Path: s.Path, Err: err}
+	}
+	return os.NewFile(uintptr(fd), s.Path), nil
+}
+
+func (s Serial) configure(fd int, speed uint32) error {
+	t, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+	t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON | unix.IXOFF | unix.IXANY
+	t.Oflag &^= unix.OPOST
+	t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	t.Cflag &^= unix.CSIZE | unix.PARENB | unix.PARODD | unix.CSTOPB | unix.CRTSCTS | unix.CBAUD
+	t.Cflag |= unix.CREAD | unix.CLOCAL | speed
+	switch s.DataBits {
+	case 5:
+		t.Cflag |= unix.CS5
+	case 6:
+		t.Cflag |= unix.CS6
+	case 7:
+		t.Cflag |= unix.CS7
+	default:
+		t.Cflag |= unix.CS8
+	}
+	switch s.Parity {
+	case 'E':
+		t.Cflag |= unix.PARENB
+	case 'O':
+		t.Cflag |= unix.PARENB | unix.PARODD
+	}
+	if s.StopBits == 2 {
+		t.Cflag |= unix.CSTOPB
+	}
+	t.Ispeed, t.Ospeed = speed, speed
+	t.Cc[unix.VMIN], t.Cc[unix.VTIME] = 1, 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, t); err != nil {
+		return err
+	}
+	// Drop anything the adapter buffered before we opened it.
+	return unix.IoctlSetInt(fd, unix.TCFLSH, unix.TCIOFLUSH)
+}
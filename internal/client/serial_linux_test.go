@@ -0,0 +1,65 @@
+package client_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SiirRandall/tesmart-ui/internal/client"
+	"github.com/SiirRandall/tesmart-ui/internal/simulator"
+)
+
+// The frame logic runs unchanged over a tty: the simulator serves the master
+// side of a pseudo-terminal pair and the client opens the slave.
+func TestSerialPTY(t *testing.T) {
+	for _, persist := range []bool{false, true} {
+		name := "per command"
+		if persist {
+			name = "persistent"
+		}
+		t.Run(name, func(t *testing.T) {
+			st := simulator.DefaultState()
+			st.Active = 3
+			sim := simulator.New(st)
+			sim.Logf = func(string, ...any) {}
+			path, err := sim.ServePTY()
+			if err != nil {
+				t.Skipf("no pseudo-terminals: %v", err)
+			}
+			t.Cleanup(func() { _ = sim.Close() })
+
+			s, err := client.NewSerial(path, 9600, "8N1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			cli := client.New("", 0, testGetTO, testSetTO)
+			cli.SetTransport(s, testGetTO, testSetTO)
+			cli.SetSession(persist, 0, 0)
+			t.Cleanup(func() { _ = cli.Close() })
+
+			if got, err := cli.GetActiveInput(); err != nil || got != 3 {
+				t.Fatalf("GetActiveInput = %d, %v; want 3", got, err)
+			}
+			if err := cli.SetInput(6); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := cli.GetActiveInput(); err != nil || got != 6 {
+				t.Fatalf("after SetInput(6): %d, %v", got, err)
+			}
+			if got := sim.State().Active; got != 6 {
+				t.Errorf("simulator on %d, want 6", got)
+			}
+		})
+	}
+}
+
+// A baud rate the tty layer does not know is a settings mistake, not an
+// unreachable switch.
+func TestSerialBadBaud(t *testing.T) {
+	s, _ := client.NewSerial("/dev/null", 1234, "8N1")
+	cli := client.New("", 0, testGetTO, testSetTO)
+	cli.SetTransport(s, testGetTO, testSetTO)
+	_, err := cli.GetActiveInput()
+	if !errors.Is(err, client.ErrConfig) || errors.Is(err, client.ErrUnreachable) {
+		t.Fatalf("error = %v, want ErrConfig only", err)
+	}
+}
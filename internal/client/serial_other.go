@@ -0,0 +1,12 @@
+//go:build !linux
+
+package client
+
+import (
+	"context"
+	"time"
+)
+
+func (s Serial) Open(context.Context, time.Duration) (Conn, error) {
+	return nil, ErrSerialUnsupported
+}
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+)
+
+// Conn is one open link to a switch. net.Conn and *os.File (for ttys opened
+// non-blocking) both satisfy it.
+type Conn interface {
+	io.ReadWriteCloser
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// Transport opens links to a switch. The frame logic in Client is the same
+// for every transport.
+type Transport interface {
+	Open(ctx context.Context, timeout time.Duration) (Conn, error)
+	String() string // human-readable target, e.g. "192.168.1.10:5000"
+}
+
+// TCP reaches the switch over its LAN port.
+type TCP struct {
+	Addr      string        // host:port
+	KeepAlive time.Duration // TCP keepalive period; 0 = OS default
+}
+
+func (t TCP) Open(ctx context.Context, timeout time.Duration) (Conn, error) {
+	d := net.Dialer{Timeout: timeout, KeepAlive: t.KeepAlive}
+	return d.DialContext(ctx, "tcp", t.Addr)
+}
+
+func (t TCP) String() string { return t.Addr }
@@ -2,9 +2,13 @@ package config
 
 import (
 	"bytes"
+	"fmt"
+	"maps"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,21 +16,129 @@ import (
 )
 
 type PortMeta struct {
-	Name string `yaml:"name"`
-	Icon string `yaml:"icon"`
+	Name  string `yaml:"name"`
+	Icon  string `yaml:"icon"`
+	Hooks `yaml:",inline"`
 }
 
+// Hooks are shell commands run when an input becomes active (OnEnter) or
+// stops being active (OnLeave).
+type Hooks struct {
+	OnEnter string `yaml:"on_enter,omitempty"`
+	OnLeave string `yaml:"on_leave,omitempty"`
+}
+
+// SerialPort is the RS-232 / USB-serial link of a switch.
+type SerialPort struct {
+	Path    string `yaml:"path"`
+	Baud    int    `yaml:"baud"`
+	Framing string `yaml:"framing"` // e.g. 8N1
+}
+
+// Device is one switch managed by the app.
+type Device struct {
+	Name            string           `yaml:"name"`
+	Transport       string           `yaml:"transport"` // "tcp" or "serial"
+	IP              string           `yaml:"ip"`
+	Port            int              `yaml:"port"`
+	Serial          SerialPort       `yaml:"serial"`
+	Model           string           `yaml:"model"`
+	CascadeUnits    int              `yaml:"cascade_units"`
+	ZeroBasedSwitch bool             `yaml:"zero_based_switch"`
+	Ports           map[int]PortMeta `yaml:"ports"`
+	PollIntervalMs  int              `yaml:"poll_interval_ms"`
+	BackoffMaxMs    int              `yaml:"poll_backoff_max_ms"`
+	GetTimeoutMs    int              `yaml:"get_timeout_ms"`
+	SetTimeoutMs    int              `yaml:"set_timeout_ms"`
+	AdaptiveTimeout bool             `yaml:"adaptive_timeouts"`
+	TimeoutMinMs    int              `yaml:"timeout_min_ms"`
+	TimeoutMaxMs    int              `yaml:"timeout_max_ms"`
+	PersistentConn  bool             `yaml:"persistent_conn"`
+	KeepAliveMs     int              `yaml:"keepalive_ms"`
+	IdleTimeoutMs   int              `yaml:"idle_timeout_ms"`
+	Listen          bool             `yaml:"listen"`
+	HeartbeatMs     int              `yaml:"heartbeat_ms"`
+}
+
+// MQTT is the broker the Home Assistant bridge publishes to.
+type MQTT struct {
+	Broker          string `yaml:"broker"` // e.g. tcp://localhost:1883; empty disables the bridge
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password"`
+	ClientID        string `yaml:"client_id"`
+	TopicPrefix     string `yaml:"topic_prefix"`
+	DiscoveryPrefix string `yaml:"discovery_prefix"`
+}
+
+// Preset is a named sequence of actions, possibly over several switches.
+type Preset struct {
+	Name  string       `yaml:"name"`
+	Steps []PresetStep `yaml:"steps"`
+}
+
+// PresetStep does one thing to one switch (the first if Device is empty):
+// exactly one of Input, Buzzer ("on"/"off") and LED ("off"/"10s"/"30s").
+type PresetStep struct {
+	Device string `yaml:"device,omitempty"`
+	Input  string `yaml:"input,omitempty"`
+	Buzzer string `yaml:"buzzer,omitempty"`
+	LED    string `yaml:"led,omitempty"`
+}
+
+// Action names what the step does and its argument.
+func (s PresetStep) Action() (action, value string, err error) {
+	var set []string
+	if s.Input != "" {
+		action, value, set = "input", s.Input, append(set, "input")
+	}
+	if s.Buzzer != "" {
+		action, value, set = "buzzer", s.Buzzer, append(set, "buzzer")
+	}
+	if s.LED != "" {
+		action, value, set = "led", s.LED, append(set, "led")
+	}
+	if len(set) != 1 {
+		return "", "", fmt.Errorf("a step needs exactly one of input, buzzer or led")
+	}
+	return action, value, nil
+}
+
+// Schedule switches Device (the first switch if empty) to Input, a number or
+// port name, whenever Cron matches. See the schedule package for the syntax.
+type Schedule struct {
+	Name   string `yaml:"name,omitempty"`
+	Cron   string `yaml:"cron"`
+	Device string `yaml:"device,omitempty"`
+	Input  string `yaml:"input"`
+}
+
+// What to do about runs missed while the computer slept or was off.
+const (
+	MissedSkip      = "skip"       // drop them; wait for the next run
+	MissedRunLatest = "run_latest" // run the most recent one on waking
+)
+
 type Config struct {
-	IP               string           `yaml:"ip"`
-	Port             int              `yaml:"port"`
-	Ports            map[int]PortMeta `yaml:"ports"`
-	PollIntervalMs   int              `yaml:"poll_interval_ms"`
-	FastMode         bool             `yaml:"fast_mode"`
-	GetTimeoutMs     int              `yaml:"get_timeout_ms"`
-	SetTimeoutMs     int              `yaml:"set_timeout_ms"`
-	VerifyAfterSet   bool             `yaml:"verify_after_set"`
-	SwitchSuppressMs int              `yaml:"switch_suppress_ms"`
-	SetupCompleted   bool             `yaml:"setup_completed"`
+	Devices          []*Device `yaml:"devices"`
+	FastMode         bool      `yaml:"fast_mode"`
+	VerifyAfterSet   bool      `yaml:"verify_after_set"`
+	SwitchSuppressMs int       `yaml:"switch_suppress_ms"`
+	SetupCompleted   bool      `yaml:"setup_completed"`
+
+	// APIListen makes the GUI serve the HTTP API (as "tesmart-ui serve"
+	// does) on this address; empty disables it.
+	APIListen string `yaml:"api_listen"`
+
+	MQTT MQTT `yaml:"mqtt"`
+
+	// Hooks run for every input of every switch, after the per-port ones.
+	Hooks         Hooks `yaml:"hooks"`
+	HookTimeoutMs int   `yaml:"hook_timeout_ms"`
+
+	Presets []Preset `yaml:"presets"`
+
+	Schedules      []Schedule `yaml:"schedules"`
+	ScheduleMissed string     `yaml:"schedule_missed"` // MissedSkip or MissedRunLatest
 
 	fileDir  string `yaml:"-"`
 	filePath string `yaml:"-"`
@@ -34,36 +146,78 @@ type Config struct {
 	created  bool `yaml:"-"` // true if config file was created on this run
 }
 
-var defaultYAML = []byte(`# TeSmart UI (Go/Fyne) config
-ip: "192.168.1.10"
-port: 5000
-
-poll_interval_ms: 1000
-
+// defaultYAML renders the first-run config with a single switch of model m.
+func defaultYAML(m Model) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `# TeSmart UI (Go/Fyne) config
 fast_mode: false
-get_timeout_ms: 600
-set_timeout_ms: 450
 verify_after_set: true
 switch_suppress_ms: 800
 
-ports:
-  1: { name: "PC 1", icon: "" }
-  2: { name: "PC 2", icon: "" }
-  3: { name: "PC 3", icon: "" }
-  4: { name: "PC 4", icon: "" }
-  5: { name: "PC 5", icon: "" }
-  6: { name: "PC 6", icon: "" }
-  7: { name: "PC 7", icon: "" }
-  8: { name: "PC 8", icon: "" }
-  9: { name: "PC 9", icon: "" }
-  10: { name: "PC 10", icon: "" }
-  11: { name: "PC 11", icon: "" }
-  12: { name: "PC 12", icon: "" }
-  13: { name: "PC 13", icon: "" }
-  14: { name: "PC 14", icon: "" }
-  15: { name: "PC 15", icon: "" }
-  16: { name: "PC 16", icon: "" }
-`)
+# Serve the HTTP API and event stream from the GUI, e.g. "127.0.0.1:8080".
+api_listen: ""
+
+# Publish to an MQTT broker, with Home Assistant discovery.
+mqtt:
+  broker: ""   # e.g. tcp://localhost:1883
+  username: ""
+  password: ""
+  topic_prefix: tesmart
+  discovery_prefix: homeassistant
+
+# Shell commands run on input changes; ports can have their own on_enter /
+# on_leave too. See the README for the environment they get.
+hooks:
+  on_enter: ""
+  on_leave: ""
+hook_timeout_ms: 10000
+
+# Runs of schedules missed while asleep: skip, or run_latest to catch up
+# with the most recent one on waking.
+schedule_missed: skip
+
+devices:
+  - name: "Switch 1"
+    transport: tcp   # or serial
+    ip: "192.168.1.10"
+    port: 5000
+    serial: { path: "/dev/ttyUSB0", baud: 9600, framing: "8N1" }
+
+    # One of: hdmi-4, hdmi-8, hdmi-16. cascade_units multiplies the inputs
+    # for cascaded switches.
+    model: %q
+    cascade_units: 1
+    zero_based_switch: false
+
+    poll_interval_ms: 1000
+    poll_backoff_max_ms: 60000  # longest wait between polls while offline
+    get_timeout_ms: 600
+    set_timeout_ms: 450
+
+    # Learn the timeouts from measured round trips instead, within bounds.
+    adaptive_timeouts: false
+    timeout_min_ms: 100
+    timeout_max_ms: 3000
+
+    # Keep one TCP connection open instead of dialing per command.
+    persistent_conn: false
+    keepalive_ms: 15000
+    idle_timeout_ms: 30000
+
+    # Read the status frames some firmware pushes on front-panel presses
+    # (needs persistent_conn). Once the switch has pushed a change, polls
+    # only serve as a heartbeat.
+    listen: false
+    heartbeat_ms: 15000
+
+    ports:
+`, m.ID)
+	for i := 1; i <= m.Ports; i++ {
+		fmt.Fprintf(&b, "      %d: { name: \"PC %d\", icon: \"\" }\n", i, i)
+	}
+	b.WriteString("\nsetup_completed: false\n")
+	return b.Bytes()
+}
 
 func paths() (dir, file string) {
 	base, err := os.UserConfigDir()
@@ -76,6 +230,16 @@ func paths() (dir, file string) {
 	return
 }
 
+// DefaultDevice returns the switch of the first-run config for model m, so
+// first-time setup can start over with another model.
+func DefaultDevice(m Model) *Device {
+	var cfg Config
+	_ = yaml.Unmarshal(defaultYAML(m), &cfg) // our own template
+	d := cfg.Devices[0]
+	d.applyDefaults()
+	return d
+}
+
 // ensure creates the config file if missing.
 // It returns (created, error).
 func ensure(dir, file string) (bool, error) {
@@ -85,11 +249,8 @@ func ensure(dir, file string) (bool, error) {
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return false, err
 	}
-	// Make sure default includes setup_completed flag
-	if !bytes.Contains(defaultYAML, []byte("\nsetup_completed:")) {
-		defaultYAML = append(defaultYAML, []byte("\nsetup_completed: false\n")...)
-	}
-	if err := os.WriteFile(file, defaultYAML, 0o644); err != nil {
+	m, _ := LookupModel(DefaultModel)
+	if err := os.WriteFile(file, defaultYAML(m), 0o644); err != nil {
 		return false, err
 	}
 	return true, nil
@@ -109,40 +270,112 @@ func Load() (*Config, error) {
 	if err := yaml.Unmarshal(b, &cfg); err != nil {
 		return nil, err
 	}
-	if cfg.IP == "" {
-		cfg.IP = "192.168.1.10"
+	if len(cfg.Devices) == 0 {
+		// Single-switch layout from before devices existed: the old
+		// top-level keys are exactly the per-device ones.
+		var legacy Device
+		if err := yaml.Unmarshal(b, &legacy); err != nil {
+			return nil, err
+		}
+		legacy.Name = "Switch 1"
+		cfg.Devices = []*Device{&legacy}
 	}
-	if cfg.Port == 0 {
-		cfg.Port = 5000
+	// Switches are addressed by name everywhere (--device, hooks, MQTT
+	// topics, metrics labels), so names must be unique.
+	seen := map[string]bool{}
+	for i, d := range cfg.Devices {
+		if d.Name == "" {
+			d.Name = "Switch " + strconv.Itoa(i+1)
+		}
+		if seen[d.Name] {
+			return nil, fmt.Errorf("%s: more than one switch is named %q", file, d.Name)
+		}
+		seen[d.Name] = true
+		d.applyDefaults()
 	}
-	if cfg.PollIntervalMs <= 0 {
-		cfg.PollIntervalMs = 1000
+	if cfg.SwitchSuppressMs <= 0 {
+		cfg.SwitchSuppressMs = 800
 	}
-	if cfg.GetTimeoutMs <= 0 {
-		cfg.GetTimeoutMs = 600
+	if cfg.HookTimeoutMs <= 0 {
+		cfg.HookTimeoutMs = 10000
 	}
-	if cfg.SetTimeoutMs <= 0 {
-		cfg.SetTimeoutMs = 450
+	if cfg.ScheduleMissed != MissedRunLatest {
+		cfg.ScheduleMissed = MissedSkip
 	}
-	if cfg.SwitchSuppressMs <= 0 {
-		cfg.SwitchSuppressMs = 800
+	if cfg.MQTT.ClientID == "" {
+		cfg.MQTT.ClientID = "tesmart-ui"
 	}
-	if cfg.Ports == nil {
-		cfg.Ports = map[int]PortMeta{}
+	if cfg.MQTT.TopicPrefix == "" {
+		cfg.MQTT.TopicPrefix = "tesmart"
 	}
-	for i := 1; i <= 16; i++ {
-		if _, ok := cfg.Ports[i]; !ok {
-			cfg.Ports[i] = PortMeta{Name: "Port " + strconv.Itoa(i)}
-		}
+	if cfg.MQTT.DiscoveryPrefix == "" {
+		cfg.MQTT.DiscoveryPrefix = "homeassistant"
 	}
 	cfg.fileDir, cfg.filePath = dir, file
 	cfg.created = created
 	return &cfg, nil
 }
 
+func (d *Device) applyDefaults() {
+	if d.Transport != "serial" {
+		d.Transport = "tcp"
+	}
+	if d.Serial.Baud <= 0 {
+		d.Serial.Baud = 9600
+	}
+	if d.Serial.Framing == "" {
+		d.Serial.Framing = "8N1"
+	}
+	if d.IP == "" {
+		d.IP = "192.168.1.10"
+	}
+	if d.Port == 0 {
+		d.Port = 5000
+	}
+	if _, ok := LookupModel(d.Model); !ok {
+		d.Model = DefaultModel
+	}
+	if d.CascadeUnits <= 0 {
+		d.CascadeUnits = 1
+	}
+	if d.PollIntervalMs <= 0 {
+		d.PollIntervalMs = 1000
+	}
+	if d.BackoffMaxMs <= 0 {
+		d.BackoffMaxMs = 60000
+	}
+	if d.GetTimeoutMs <= 0 {
+		d.GetTimeoutMs = 600
+	}
+	if d.SetTimeoutMs <= 0 {
+		d.SetTimeoutMs = 450
+	}
+	if d.TimeoutMinMs <= 0 {
+		d.TimeoutMinMs = 100
+	}
+	if d.TimeoutMaxMs < d.TimeoutMinMs {
+		d.TimeoutMaxMs = max(3000, d.TimeoutMinMs)
+	}
+	if d.KeepAliveMs <= 0 {
+		d.KeepAliveMs = 15000
+	}
+	if d.IdleTimeoutMs < 0 {
+		d.IdleTimeoutMs = 0
+	}
+	if d.HeartbeatMs <= 0 {
+		d.HeartbeatMs = 15000
+	}
+	d.FillPorts()
+}
+
 func (c *Config) Save() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	for _, d := range c.Devices {
+		l := d.lock()
+		l.RLock()
+		defer l.RUnlock()
+	}
 	out, err := yaml.Marshal(c)
 	if err != nil {
 		return err
@@ -150,11 +383,203 @@ func (c *Config) Save() error {
 	return os.WriteFile(c.filePath, out, 0o644)
 }
 
+// Preset returns the preset with the given name, or nil.
+func (c *Config) Preset(name string) *Preset {
+	for i := range c.Presets {
+		if c.Presets[i].Name == name {
+			return &c.Presets[i]
+		}
+	}
+	return nil
+}
+
+// Device returns the device with the given name, or nil.
+func (c *Config) Device(name string) *Device {
+	for _, d := range c.Devices {
+		if d.CurrentName() == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// AddDevice appends a new switch with defaults filled in. The name is made
+// unique if it clashes with an existing device.
+func (c *Config) AddDevice(d *Device) *Device {
+	base, name := d.Name, d.Name
+	if base == "" {
+		base = "Switch"
+		name = "Switch " + strconv.Itoa(len(c.Devices)+1)
+	}
+	for i := 2; c.Device(name) != nil; i++ {
+		name = base + " " + strconv.Itoa(i)
+	}
+	d.Name = name
+	d.applyDefaults()
+	c.Devices = append(c.Devices, d)
+	return d
+}
+
+// RemoveDevice drops d from the device list.
+func (c *Config) RemoveDevice(d *Device) {
+	for i, x := range c.Devices {
+		if x == d {
+			c.Devices = append(c.Devices[:i], c.Devices[i+1:]...)
+			return
+		}
+	}
+}
+
+// Profile resolves the configured model and cascade into the effective profile.
+func (d *Device) Profile() Profile {
+	m, ok := LookupModel(d.Model)
+	if !ok {
+		m, _ = LookupModel(DefaultModel)
+	}
+	if d.ZeroBasedSwitch {
+		m.ZeroBasedSwitch = true
+	}
+	units := d.CascadeUnits
+	if units < 1 {
+		units = 1
+	}
+	return Profile{Model: m, Units: units}
+}
+
+// IsSerial reports whether the switch is reached over its serial port.
+func (d *Device) IsSerial() bool { return d.Transport == "serial" }
+
+// Target describes where the switch is reached, for status lines.
+func (d *Device) Target() string {
+	if d.IsSerial() {
+		return d.Serial.Path
+	}
+	return net.JoinHostPort(d.IP, strconv.Itoa(d.Port))
+}
+
+// PortCount is the number of inputs of the configured switch.
+func (d *Device) PortCount() int { return d.Profile().PortCount() }
+
+// Entries in Config.Devices are shared with the switches using them. Once
+// in use, an entry is read through Snapshot and changed through Update, so
+// that Save never writes half an edit.
+
+// entryLocks holds a lock per entry, kept outside Device so that copying
+// an entry neither copies nor writes it.
+var entryLocks sync.Map // *Device → *sync.RWMutex
+
+func (d *Device) lock() *sync.RWMutex {
+	if l, ok := entryLocks.Load(d); ok {
+		return l.(*sync.RWMutex)
+	}
+	l, _ := entryLocks.LoadOrStore(d, new(sync.RWMutex))
+	return l.(*sync.RWMutex)
+}
+
+// Snapshot returns a copy of d, with a Ports map of its own.
+func (d *Device) Snapshot() *Device {
+	l := d.lock()
+	l.RLock()
+	defer l.RUnlock()
+	c := *d
+	c.Ports = maps.Clone(d.Ports)
+	return &c
+}
+
+// Update replaces d's settings with a copy of c's, filling in missing ports.
+func (d *Device) Update(c *Device) {
+	nc := *c
+	nc.Ports = maps.Clone(c.Ports)
+	nc.FillPorts()
+	l := d.lock()
+	l.Lock()
+	defer l.Unlock()
+	*d = nc
+}
+
+// CurrentName returns d's name, read under the entry's lock.
+func (d *Device) CurrentName() string {
+	l := d.lock()
+	l.RLock()
+	defer l.RUnlock()
+	return d.Name
+}
+
+// FillPorts gives every input of the configured model a PortMeta entry.
+// Entries beyond the port count are kept so switching models is lossless.
+func (d *Device) FillPorts() {
+	if d.Ports == nil {
+		d.Ports = map[int]PortMeta{}
+	}
+	for i := 1; i <= d.PortCount(); i++ {
+		if _, ok := d.Ports[i]; !ok {
+			d.Ports[i] = PortMeta{Name: "Port " + strconv.Itoa(i)}
+		}
+	}
+}
+
+// InputName is the display name of input i, "Port i" if it has none.
+func (d *Device) InputName(i int) string {
+	if name := d.Ports[i].Name; name != "" {
+		return name
+	}
+	return "Port " + strconv.Itoa(i)
+}
+
+// ResolveInput maps an input name or number to a port. Exact names win over
+// numbers, so an input named "2" can still be addressed; names are then
+// matched case-insensitively.
+func (d *Device) ResolveInput(s string) (int, error) {
+	n := d.PortCount()
+	for i := 1; i <= n; i++ {
+		if d.InputName(i) == s {
+			return i, nil
+		}
+	}
+	if p, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+		if p < 1 || p > n {
+			return 0, fmt.Errorf("input %d out of range 1..%d", p, n)
+		}
+		return p, nil
+	}
+	for i := 1; i <= n; i++ {
+		if strings.EqualFold(d.InputName(i), strings.TrimSpace(s)) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown input: %s", s)
+}
+
 func (c *Config) Dir() string  { return c.fileDir }
 func (c *Config) Path() string { return c.filePath }
 
-func (c *Config) GetTimeout() time.Duration { return time.Duration(c.GetTimeoutMs) * time.Millisecond }
-func (c *Config) SetTimeout() time.Duration { return time.Duration(c.SetTimeoutMs) * time.Millisecond }
+func (c *Config) HookTimeout() time.Duration {
+	return time.Duration(c.HookTimeoutMs) * time.Millisecond
+}
+
+// VerifySwitch reports whether switches are read back to confirm them:
+// verify_after_set, unless fast_mode skips the read-back.
+func (c *Config) VerifySwitch() bool { return !c.FastMode && c.VerifyAfterSet }
+
+func (c *Config) SwitchSuppress() time.Duration {
+	return time.Duration(c.SwitchSuppressMs) * time.Millisecond
+}
+
+func (d *Device) GetTimeout() time.Duration { return time.Duration(d.GetTimeoutMs) * time.Millisecond }
+func (d *Device) SetTimeout() time.Duration { return time.Duration(d.SetTimeoutMs) * time.Millisecond }
+func (d *Device) TimeoutMin() time.Duration { return time.Duration(d.TimeoutMinMs) * time.Millisecond }
+func (d *Device) TimeoutMax() time.Duration { return time.Duration(d.TimeoutMaxMs) * time.Millisecond }
+func (d *Device) PollInterval() time.Duration {
+	return time.Duration(d.PollIntervalMs) * time.Millisecond
+}
+func (d *Device) PollBackoffMax() time.Duration {
+	return time.Duration(d.BackoffMaxMs) * time.Millisecond
+}
+func (d *Device) KeepAlive() time.Duration { return time.Duration(d.KeepAliveMs) * time.Millisecond }
+func (d *Device) IdleTimeout() time.Duration {
+	return time.Duration(d.IdleTimeoutMs) * time.Millisecond
+}
+func (d *Device) Heartbeat() time.Duration { return time.Duration(d.HeartbeatMs) * time.Millisecond }
 
 // WasJustCreated reports whether the config file was created on this run.
 func (c *Config) WasJustCreated() bool { return c.created }
@@ -0,0 +1,59 @@
+package config
+
+import "fmt"
+
+// Model describes a TESmart hardware variant: how many inputs it has and how
+// it expects to be driven.
+type Model struct {
+	ID    string
+	Name  string
+	Ports int // inputs on a single unit
+	// ZeroBasedSwitch marks firmware that wants the 0-based 0x11 switch
+	// command first instead of the 1-based 0x01 one.
+	ZeroBasedSwitch bool
+}
+
+// DefaultModel is used when the config names no (or an unknown) model.
+const DefaultModel = "hdmi-16"
+
+// MaxPorts caps cascaded setups; the protocol addresses inputs with one byte.
+const MaxPorts = 255
+
+var Models = []Model{
+	{ID: "hdmi-4", Name: "TESmart 4-Port", Ports: 4},
+	{ID: "hdmi-8", Name: "TESmart 8-Port", Ports: 8},
+	{ID: "hdmi-16", Name: "TESmart 16-Port", Ports: 16},
+}
+
+// LookupModel returns the model with the given ID.
+func LookupModel(id string) (Model, bool) {
+	for _, m := range Models {
+		if m.ID == id {
+			return m, true
+		}
+	}
+	return Model{}, false
+}
+
+// Profile is the effective model of a configured switch, cascades included.
+type Profile struct {
+	Model
+	Units int // cascaded units, 1 for a standalone switch
+}
+
+// PortCount is the number of addressable inputs across all cascaded units.
+func (p Profile) PortCount() int {
+	n := p.Ports * p.Units
+	if n > MaxPorts {
+		n = MaxPorts
+	}
+	return n
+}
+
+// Title is a display name such as "TESmart 8-Port" or "TESmart 16-Port ×2".
+func (p Profile) Title() string {
+	if p.Units > 1 {
+		return fmt.Sprintf("%s ×%d", p.Name, p.Units)
+	}
+	return p.Name
+}
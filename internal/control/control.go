@@ -0,0 +1,177 @@
+// Package control is the local channel between tesmart-ui processes. The
+// first instance (GUI or serve) listens on a Unix socket in the user's
+// runtime directory; later invocations forward their command to it instead
+// of opening their own connection to the switch.
+//
+// Each connection carries one JSON Request line and one schema.Result line
+// back. Closing the connection early cancels the command.
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+)
+
+// Commands handled besides the CLI ones.
+const (
+	CmdShow   = "show"   // bring the window to the front
+	CmdReload = "reload" // re-read the config file
+)
+
+type Request struct {
+	Command string   `json:"command"`
+	Device  string   `json:"device,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	Timeout int64    `json:"timeout_ms,omitempty"` // 0 = none
+}
+
+// Handler executes req and fills in r. ctx is cancelled if the requester
+// goes away or its timeout passes.
+type Handler func(ctx context.Context, req Request, r *schema.Result)
+
+var (
+	ErrRunning    = errors.New("another instance is running")
+	ErrNotRunning = errors.New("no running instance")
+)
+
+// SocketPath is $XDG_RUNTIME_DIR/tesmart-ui/control.sock, or a per-user
+// directory under the temp dir when XDG_RUNTIME_DIR is unset.
+func SocketPath() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir != "" {
+		dir = filepath.Join(dir, "tesmart-ui")
+	} else {
+		dir = filepath.Join(os.TempDir(), "tesmart-ui-"+strconv.Itoa(os.Getuid()))
+	}
+	return filepath.Join(dir, "control.sock")
+}
+
+/* Owner side */
+
+type Server struct {
+	ln   net.Listener
+	path string
+}
+
+// Listen claims the control socket. It returns ErrRunning if another
+// instance answers on it; a socket left behind by a crashed instance is
+// replaced. Instances starting at the same time take turns through a lock
+// file next to the socket, so one cannot remove the other's fresh socket.
+func Listen() (*Server, error) {
+	path := SocketPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if err := checkDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		c.Close()
+		return nil, ErrRunning
+	}
+	_ = os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{ln: ln, path: path}, nil
+}
+
+// Serve answers requests with h until Close.
+func (s *Server) Serve(h Handler) {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn, h)
+	}
+}
+
+// Close stops serving and removes the socket.
+func (s *Server) Close() error {
+	if unlock, err := lockFile(s.path + ".lock"); err == nil {
+		defer unlock()
+	}
+	err := s.ln.Close()
+	_ = os.Remove(s.path)
+	return err
+}
+
+func (s *Server) serveConn(conn net.Conn, h Handler) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return
+	}
+	var req Request
+	r := schema.New("")
+	if err := json.Unmarshal(line, &req); err != nil {
+		r.Error = &schema.Error{Kind: schema.KindUsage, Message: "invalid request: " + err.Error()}
+		_ = json.NewEncoder(conn).Encode(r)
+		return
+	}
+	r.Command = req.Command
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if req.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(req.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+	go func() {
+		// The requester sends nothing more; EOF means it gave up.
+		_, _ = br.ReadByte()
+		cancel()
+	}()
+	h(ctx, req, r)
+	_ = json.NewEncoder(conn).Encode(r)
+}
+
+/* Requester side */
+
+// Send forwards req to the running instance and returns its result. It
+// returns ErrNotRunning if there is none.
+func Send(ctx context.Context, req Request) (*schema.Result, error) {
+	path := SocketPath()
+	if checkDir(filepath.Dir(path)) != nil {
+		return nil, ErrNotRunning // not a socket we can trust
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, ErrNotRunning
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	b, _ := json.Marshal(req)
+	if _, err := conn.Write(append(b, '\n')); err != nil {
+		return nil, fmt.Errorf("control: %w", err)
+	}
+	var r schema.Result
+	if err := json.NewDecoder(conn).Decode(&r); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("control: %w", err)
+	}
+	return &r, nil
+}
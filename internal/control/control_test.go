@@ -0,0 +1,99 @@
+package control_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/SiirRandall/tesmart-ui/internal/control"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+)
+
+func TestListenSend(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	if _, err := control.Send(context.Background(), control.Request{Command: "status"}); !errors.Is(err, control.ErrNotRunning) {
+		t.Fatalf("Send without an instance: %v", err)
+	}
+
+	srv, err := control.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(func(_ context.Context, req control.Request, r *schema.Result) {
+		r.Device = req.Device
+	})
+	if _, err := control.Listen(); !errors.Is(err, control.ErrRunning) {
+		t.Fatalf("second Listen: %v", err)
+	}
+	r, err := control.Send(context.Background(), control.Request{Command: "status", Device: "Rack"})
+	if err != nil || r.Command != "status" || r.Device != "Rack" {
+		t.Fatalf("Send = %+v, %v", r, err)
+	}
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(control.SocketPath()); !os.IsNotExist(err) {
+		t.Fatalf("socket left behind: %v", err)
+	}
+}
+
+// A socket left by a crashed instance is replaced.
+func TestListenStale(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	path := control.SocketPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	srv, err := control.Listen()
+	if err != nil {
+		t.Fatalf("Listen over a stale socket: %v", err)
+	}
+	srv.Close()
+}
+
+// Of several instances starting at once, exactly one gets the socket.
+func TestListenConcurrent(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		owners  []*control.Server
+		running int
+	)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			srv, err := control.Listen()
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				owners = append(owners, srv)
+			case errors.Is(err, control.ErrRunning):
+				running++
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, srv := range owners {
+		go srv.Serve(func(context.Context, control.Request, *schema.Result) {})
+	}
+	if len(owners) != 1 || running != 7 {
+		t.Fatalf("%d owners, %d told another instance runs", len(owners), running)
+	}
+	owners[0].Close()
+}
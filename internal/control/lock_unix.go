@@ -0,0 +1,47 @@
+//go:build unix && !aix
+
+package control
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// checkDir refuses a socket directory that another user could have
+// prepared: it must be a real directory, ours, and private.
+func checkDir(dir string) error {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	st, _ := fi.Sys().(*syscall.Stat_t)
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		return fmt.Errorf("control: %s is a symlink", dir)
+	case !fi.IsDir():
+		return fmt.Errorf("control: %s is not a directory", dir)
+	case st == nil || int(st.Uid) != os.Getuid():
+		return fmt.Errorf("control: %s is owned by another user", dir)
+	case fi.Mode().Perm() != 0o700:
+		return fmt.Errorf("control: %s has mode %#o, want 0700", dir, fi.Mode().Perm())
+	}
+	return nil
+}
+
+// lockFile takes an exclusive flock on path, waiting for other instances to
+// finish claiming or releasing the socket. Call the returned func to release
+// it.
+func lockFile(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("control: lock %s: %w", path, err)
+	}
+	return func() { f.Close() }, nil // closing drops the lock
+}
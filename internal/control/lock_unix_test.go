@@ -0,0 +1,54 @@
+//go:build unix && !aix
+
+package control_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SiirRandall/tesmart-ui/internal/control"
+)
+
+// Without XDG_RUNTIME_DIR the socket lives in the shared temp dir, where
+// another user could have created the directory first.
+func TestListenFallbackDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(dir string) error
+		ok      bool
+	}{
+		{"created", func(string) error { return nil }, true},
+		{"private", func(dir string) error { return os.Mkdir(dir, 0o700) }, true},
+		{"group readable", func(dir string) error {
+			if err := os.Mkdir(dir, 0o700); err != nil {
+				return err
+			}
+			return os.Chmod(dir, 0o750)
+		}, false},
+		{"symlink", func(dir string) error {
+			target := dir + "-target"
+			if err := os.Mkdir(target, 0o700); err != nil {
+				return err
+			}
+			return os.Symlink(target, dir)
+		}, false},
+		{"file", func(dir string) error { return os.WriteFile(dir, nil, 0o600) }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_RUNTIME_DIR", "")
+			t.Setenv("TMPDIR", t.TempDir())
+			if err := tt.prepare(filepath.Dir(control.SocketPath())); err != nil {
+				t.Fatal(err)
+			}
+			srv, err := control.Listen()
+			if err == nil {
+				srv.Close()
+			}
+			if (err == nil) != tt.ok {
+				t.Fatalf("Listen: %v, want success %v", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+//go:build linux
+
+// Package dbus exports the switches on the session bus. Methods act on the
+// first configured switch; the signal covers all of them.
+//
+//	SwitchInput(i port)
+//	SwitchInputByName(s name)
+//	GetActiveInput() -> (i port, s name)
+//	ListInputs() -> a(is)
+//	signal ActiveInputChanged(s device, i port, s name)
+package dbus
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+	"github.com/SiirRandall/tesmart-ui/internal/events"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+)
+
+const (
+	Name  = "io.github.SiirRandall.TesmartUI"
+	Iface = Name
+	Path  = godbus.ObjectPath("/io/github/SiirRandall/TesmartUI")
+)
+
+var errNoSwitch = errors.New("no switch configured")
+
+// Service owns Name on the session bus while started.
+type Service struct {
+	cfg    *config.Config
+	lookup func(name string) *device.Device
+	events *events.Bus
+	conn   *godbus.Conn
+}
+
+// Input is one entry of ListInputs.
+type Input struct {
+	Port int32
+	Name string
+}
+
+// New prepares the service; lookup resolves a switch name, "" being the
+// first switch.
+func New(cfg *config.Config, lookup func(string) *device.Device, bus *events.Bus) *Service {
+	return &Service{cfg: cfg, lookup: lookup, events: bus}
+}
+
+// Start connects to the session bus, exports the service and claims Name.
+// It fails without a session bus (e.g. over SSH) or if another process owns
+// the name.
+func (s *Service) Start() error {
+	conn, err := godbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	m := methods{s}
+	if err := conn.Export(m, Path, Iface); err != nil {
+		conn.Close()
+		return err
+	}
+	node := &introspect.Node{
+		Name: string(Path),
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			{
+				Name:    Iface,
+				Methods: introspect.Methods(m),
+				Signals: []introspect.Signal{{
+					Name: "ActiveInputChanged",
+					Args: []introspect.Arg{{Name: "device", Type: "s"}, {Name: "port", Type: "i"}, {Name: "name", Type: "s"}},
+				}},
+			},
+		},
+	}
+	_ = conn.Export(introspect.NewIntrospectable(node), Path, "org.freedesktop.DBus.Introspectable")
+	reply, err := conn.RequestName(Name, godbus.NameFlagDoNotQueue)
+	switch {
+	case err != nil:
+		conn.Close()
+		return fmt.Errorf("could not own %s: %w", Name, err)
+	case reply != godbus.RequestNameReplyPrimaryOwner:
+		conn.Close()
+		return fmt.Errorf("could not own %s: another process has it", Name)
+	}
+	s.conn = conn
+	go s.emitInputChanges()
+	return nil
+}
+
+// Close releases the name and disconnects.
+func (s *Service) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// emitInputChanges turns input_changed events into ActiveInputChanged
+// signals until the connection closes. If it falls behind on the bus, it
+// resumes after the last event it saw.
+func (s *Service) emitInputChanges() {
+	done := s.conn.Context().Done()
+	backlog, ch, cancel := s.events.Subscribe(0)
+	defer func() { cancel() }()
+	var last uint64
+	if len(backlog) > 0 {
+		last = backlog[len(backlog)-1].Seq // from before we started; not signalled
+	}
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				backlog, ch, cancel = s.events.Subscribe(last)
+				for _, e := range backlog {
+					if !s.emit(e) {
+						return
+					}
+					last = e.Seq
+				}
+				continue
+			}
+			if !s.emit(e) {
+				return
+			}
+			last = e.Seq
+		case <-done:
+			return
+		}
+	}
+}
+
+// emit signals e if it is an input change; it returns false once the
+// connection is unusable.
+func (s *Service) emit(e schema.Event) bool {
+	if e.Type != schema.EventInputChanged {
+		return true
+	}
+	err := s.conn.Emit(Path, Iface+".ActiveInputChanged", e.Device, int32(e.Input.Port), e.Input.Name)
+	if err != nil {
+		log.Printf("[dbus] %v", err)
+		return false
+	}
+	return true
+}
+
+/* Methods */
+
+// methods is the exported object; only its methods are on the bus.
+type methods struct{ s *Service }
+
+func (m methods) device() (*device.Device, *godbus.Error) {
+	d := m.s.lookup("")
+	if d == nil {
+		return nil, godbus.MakeFailedError(errNoSwitch)
+	}
+	return d, nil
+}
+
+func (m methods) switchTo(d *device.Device, port int) *godbus.Error {
+	cfg := m.s.cfg
+	if _, err := d.Switch(port, cfg.VerifySwitch(), schema.SourceDBus); err != nil {
+		return godbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+func (m methods) SwitchInput(port int32) *godbus.Error {
+	d, derr := m.device()
+	if derr != nil {
+		return derr
+	}
+	return m.switchTo(d, int(port))
+}
+
+func (m methods) SwitchInputByName(name string) *godbus.Error {
+	d, derr := m.device()
+	if derr != nil {
+		return derr
+	}
+	port, err := d.Config().ResolveInput(name)
+	if err != nil {
+		return godbus.MakeFailedError(err)
+	}
+	return m.switchTo(d, port)
+}
+
+// GetActiveInput answers from the last poll, asking the switch only if no
+// poll has succeeded yet.
+func (m methods) GetActiveInput() (int32, string, *godbus.Error) {
+	d, derr := m.device()
+	if derr != nil {
+		return 0, "", derr
+	}
+	port := d.State().Active
+	if port == 0 {
+		p, err := d.Cli.GetActiveInputContext(d.Context())
+		if err != nil {
+			return 0, "", godbus.MakeFailedError(err)
+		}
+		port = p
+	}
+	return int32(port), d.Config().InputName(port), nil
+}
+
+func (m methods) ListInputs() ([]Input, *godbus.Error) {
+	d, derr := m.device()
+	if derr != nil {
+		return nil, derr
+	}
+	dc := d.Config()
+	out := make([]Input, 0, dc.PortCount())
+	for i := 1; i <= dc.PortCount(); i++ {
+		out = append(out, Input{int32(i), dc.InputName(i)})
+	}
+	return out, nil
+}
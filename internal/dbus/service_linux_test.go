@@ -0,0 +1,182 @@
+package dbus_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	godbus "github.com/godbus/dbus/v5"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/dbus"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+	"github.com/SiirRandall/tesmart-ui/internal/events"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+	"github.com/SiirRandall/tesmart-ui/internal/simulator"
+)
+
+const busConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:dir=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// privateBus starts a dbus-daemon of its own and points the session bus at
+// it.
+func privateBus(t *testing.T) {
+	t.Helper()
+	bin, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "bus.conf")
+	if err := os.WriteFile(conf, []byte(fmt.Sprintf(busConfig, dir)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(bin, "--config-file="+conf, "--nofork", "--print-address=1")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	addr, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatalf("dbus-daemon: %v", err)
+	}
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", strings.TrimSpace(addr))
+}
+
+func newSwitch(t *testing.T, bus *events.Bus) (*simulator.Device, *device.Device) {
+	t.Helper()
+	st := simulator.DefaultState()
+	st.Active = 3
+	sim := simulator.New(st)
+	sim.Logf = func(string, ...any) {}
+	if err := sim.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sim.Close() })
+
+	m, _ := config.LookupModel(config.DefaultModel)
+	cfg := config.DefaultDevice(m)
+	addr := sim.Addr().(*net.TCPAddr)
+	cfg.Name, cfg.IP, cfg.Port = "Rack", addr.IP.String(), addr.Port
+	d := device.New(cfg, time.Second)
+	d.Events = bus
+	t.Cleanup(d.Close)
+	return sim, d
+}
+
+func TestService(t *testing.T) {
+	privateBus(t)
+	bus := events.NewBus(512)
+	sim, d := newSwitch(t, bus)
+	lookup := func(name string) *device.Device {
+		if name == "" || name == d.Name() {
+			return d
+		}
+		return nil
+	}
+	svc := dbus.New(&config.Config{VerifyAfterSet: true}, lookup, bus)
+	if err := svc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close()
+	if err := dbus.New(&config.Config{}, lookup, bus).Start(); err == nil || !strings.Contains(err.Error(), "another process") {
+		t.Fatalf("second service: %v", err)
+	}
+
+	conn, err := godbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.AddMatchSignal(godbus.WithMatchInterface(dbus.Iface)); err != nil {
+		t.Fatal(err)
+	}
+	signals := make(chan *godbus.Signal, 1024)
+	conn.Signal(signals)
+	obj := conn.Object(dbus.Name, dbus.Path)
+	dc := d.Config()
+
+	var inputs []dbus.Input
+	if err := obj.Call(dbus.Iface+".ListInputs", 0).Store(&inputs); err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) != dc.PortCount() || inputs[0] != (dbus.Input{Port: 1, Name: dc.InputName(1)}) {
+		t.Fatalf("ListInputs = %v", inputs)
+	}
+
+	var port int32
+	var name string
+	if err := obj.Call(dbus.Iface+".GetActiveInput", 0).Store(&port, &name); err != nil {
+		t.Fatal(err)
+	}
+	if port != 3 || name != dc.InputName(3) {
+		t.Fatalf("GetActiveInput = %d %q", port, name)
+	}
+
+	wantSignal := func(port int) {
+		t.Helper()
+		select {
+		case s := <-signals:
+			want := []any{"Rack", int32(port), dc.InputName(port)}
+			if s.Name != dbus.Iface+".ActiveInputChanged" || fmt.Sprint(s.Body) != fmt.Sprint(want) {
+				t.Fatalf("signal %s %v, want %v", s.Name, s.Body, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no signal for input %d", port)
+		}
+	}
+	if err := obj.Call(dbus.Iface+".SwitchInput", 0, int32(5)).Err; err != nil {
+		t.Fatal(err)
+	}
+	if got := sim.State().Active; got != 5 {
+		t.Fatalf("switched to %d, want 5", got)
+	}
+	wantSignal(5)
+	if err := obj.Call(dbus.Iface+".SwitchInputByName", 0, dc.InputName(2)).Err; err != nil {
+		t.Fatal(err)
+	}
+	wantSignal(2)
+	if err := obj.Call(dbus.Iface+".SwitchInputByName", 0, "no such input").Err; err == nil {
+		t.Fatal("switched to an unknown input")
+	}
+
+	// A burst outruns the service's subscription; it resumes where it left
+	// off, so no change is lost or repeated.
+	for i := range 300 {
+		p := i%16 + 1
+		bus.Publish(schema.Event{Type: schema.EventInputChanged, Device: "Rack",
+			Input: &schema.Input{Port: p, Name: dc.InputName(p)}})
+	}
+	for i := range 300 {
+		wantSignal(i%16 + 1)
+	}
+	select {
+	case s := <-signals:
+		t.Fatalf("extra signal %v", s.Body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
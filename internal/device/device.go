@@ -0,0 +1,486 @@
+// Package device ties a configured switch to its client and poller, so the
+// GUI (and anything else driving a switch) shares one polling and switching
+// implementation per device.
+package device
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/client"
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/events"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+)
+
+// Handlers receive poller results. They are called from the poller goroutine,
+// except OnLink, which a switch can trigger too, and OnActive, which a pushed
+// status frame can.
+type Handlers struct {
+	OnActive func(port int)      // a poll or push reported port as active
+	OnError  func(err error)     // a poll failed (not called for cancellations)
+	OnLink   func(from, to Link) // the link state changed
+}
+
+// Link is how reachable the switch is.
+type Link int
+
+const (
+	LinkUnknown  Link = iota // not polled yet
+	LinkOnline               // the last poll or switch succeeded
+	LinkDegraded             // polls are failing; still polling at the usual interval
+	LinkOffline              // OfflineAfter polls in a row failed; polls back off
+)
+
+func (l Link) String() string {
+	return [...]string{"unknown", "online", "degraded", "offline"}[l]
+}
+
+// OfflineAfter is how many polls in a row must fail for the switch to be
+// considered offline. From then on the poll interval doubles with each
+// failure, up to the device's poll_backoff_max_ms, and the polls serve as
+// probes for its return.
+const OfflineAfter = 3
+
+type Device struct {
+	Cli *client.Client
+
+	// Events, if set, receives input changes and poll failures/recoveries.
+	Events *events.Bus
+
+	cfg *config.Device // the switch's entry in the loaded config
+
+	mu          sync.Mutex
+	handlers    Handlers
+	kick        chan struct{}   // back online or lost the listener: resume the usual poll interval
+	pushes      atomic.Bool     // the switch has pushed a change; poll at the heartbeat
+	pollCtx     context.Context // cancelled by Stop
+	stopPolling context.CancelFunc
+	cancelPoll  context.CancelFunc // aborts the poll currently in flight
+
+	pendingMu     sync.Mutex
+	suppress      time.Duration // see SetSuppress
+	pendingPort   int
+	pendingUntil  time.Time
+	pendingSource string // who asked for an unverified switch, until the next poll settles it
+
+	stateMu  sync.Mutex
+	state    State
+	switches map[int]uint64 // successful switches per port
+}
+
+// State is what the device last learned about the switch.
+type State struct {
+	Active  int // 0 until known
+	Online  bool
+	Err     error // last poll failure while offline
+	Updated time.Time
+
+	Link     Link
+	Failures int           // polls failed in a row
+	Backoff  time.Duration // wait before the next poll while offline
+
+	PollsOK     uint64
+	PollsFailed uint64
+	LastPollOK  time.Time // zero until a poll succeeds
+}
+
+// New builds a device and its client from cfg.
+func New(cfg *config.Device, suppress time.Duration) *Device {
+	d := &Device{
+		cfg:      cfg,
+		Cli:      client.New(cfg.IP, cfg.Port, cfg.GetTimeout(), cfg.SetTimeout()),
+		suppress: suppress,
+		kick:     make(chan struct{}, 1),
+		pollCtx:  context.Background(),
+	}
+	d.Apply()
+	return d
+}
+
+// Config returns a snapshot of the device's config. It is not updated by
+// later edits; to change the config, edit the snapshot and pass it to
+// SetConfig.
+func (d *Device) Config() *config.Device { return d.cfg.Snapshot() }
+
+// SetConfig replaces the device's config with a copy of c, filling in
+// missing ports. The entry in the loaded config is updated in place, so
+// saving the config file picks the change up. Call Apply afterwards for
+// transport and session changes to take effect.
+func (d *Device) SetConfig(c *config.Device) { d.cfg.Update(c) }
+
+// Apply pushes the current config (transport, timeouts, model, session mode)
+// to the client. Call it after SetConfig.
+func (d *Device) Apply() {
+	c := d.Config()
+	if c.IsSerial() {
+		// An invalid framing falls back to 8N1; the UI validates it on entry.
+		s, _ := client.NewSerial(c.Serial.Path, c.Serial.Baud, c.Serial.Framing)
+		d.Cli.SetTransport(s, c.GetTimeout(), c.SetTimeout())
+	} else {
+		d.Cli.SetTarget(c.IP, c.Port, c.GetTimeout(), c.SetTimeout())
+	}
+	p := c.Profile()
+	d.Cli.SetProfile(p.PortCount(), p.ZeroBasedSwitch)
+	d.Cli.SetSession(c.PersistentConn, c.KeepAlive(), c.IdleTimeout())
+	d.Cli.SetAdaptive(c.AdaptiveTimeout, c.TimeoutMin(), c.TimeoutMax())
+	d.pushes.Store(false)
+	if c.PersistentConn && c.Listen {
+		d.Cli.SetListener(&client.Listener{OnStatus: d.pushed, OnReply: d.replied, OnDrop: d.resume})
+	} else {
+		d.Cli.SetListener(nil)
+	}
+}
+
+func (d *Device) Name() string { return d.cfg.CurrentName() }
+
+/* Polling */
+
+// Start (re)starts the poller at the device's configured interval, backing
+// off while the switch is offline. While a listener reads the changes the
+// switch pushes, the poller only checks in at the heartbeat interval.
+func (d *Device) Start(h Handlers) {
+	d.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	d.mu.Lock()
+	d.handlers = h
+	d.pollCtx, d.stopPolling = ctx, cancel
+	d.mu.Unlock()
+	go func() {
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				d.PollOnce()
+				timer.Reset(d.pollWait())
+			case <-d.kick:
+				timer.Reset(d.Config().PollInterval())
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// pollWait is the time until the next poll.
+func (d *Device) pollWait() time.Duration {
+	if st := d.State(); st.Link == LinkOffline {
+		return st.Backoff
+	}
+	c := d.Config()
+	if d.pushes.Load() && d.Cli.Listening() {
+		return max(c.Heartbeat(), c.PollInterval())
+	}
+	return c.PollInterval()
+}
+
+// resume makes the poller return to the usual interval now.
+func (d *Device) resume() {
+	select {
+	case d.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Stop halts the poller and cancels any outstanding device work it owns.
+func (d *Device) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopPolling != nil {
+		d.stopPolling()
+	}
+}
+
+// Close stops the poller and listener and drops the client's connection.
+func (d *Device) Close() {
+	d.Stop()
+	d.Cli.SetListener(nil)
+	_ = d.Cli.Close()
+}
+
+// Context is cancelled when the poller stops; use it for device work that
+// should not outlive the poller.
+func (d *Device) Context() context.Context {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.pollCtx
+}
+
+// AbortPoll cancels an in-flight poll so a user action does not queue behind it.
+func (d *Device) AbortPoll() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancelPoll != nil {
+		d.cancelPoll()
+	}
+}
+
+// PollOnce queries the active input and reports it to the handlers.
+func (d *Device) PollOnce() {
+	d.mu.Lock()
+	ctx, cancel := context.WithCancel(d.pollCtx)
+	d.cancelPoll = cancel
+	h := d.handlers
+	d.mu.Unlock()
+	defer cancel()
+
+	port, err := d.Cli.GetActiveInputContext(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return // stopped, or pre-empted by a switch
+		}
+		d.fail(err)
+		if h.OnError != nil {
+			h.OnError(err)
+		}
+		return
+	}
+	if d.shouldIgnore(port) {
+		return
+	}
+	source := d.settle(port, schema.SourcePoll)
+	d.stateMu.Lock()
+	d.state.PollsOK++
+	d.state.LastPollOK = time.Now()
+	d.stateMu.Unlock()
+	d.observe(port, source)
+	if h.OnActive != nil {
+		h.OnActive(port)
+	}
+}
+
+// pushed handles a status frame the switch sent on its own. Only a push
+// that changes the input proves the firmware pushes; one that does not may
+// answer another client's query.
+func (d *Device) pushed(port int) { d.unprompted(port, true) }
+
+// replied handles the late reply to a command of ours that had timed out:
+// it tells the state like a poll, but proves nothing about pushes.
+func (d *Device) replied(port int) { d.unprompted(port, false) }
+
+func (d *Device) unprompted(port int, push bool) {
+	if d.shouldIgnore(port) {
+		return
+	}
+	fallback := schema.SourcePoll
+	if push {
+		fallback = schema.SourcePush
+		if prev := d.State().Active; prev != 0 && prev != port {
+			d.pushes.Store(true)
+		}
+	}
+	source := d.settle(port, fallback)
+	d.observe(port, source)
+	d.mu.Lock()
+	h := d.handlers.OnActive
+	d.mu.Unlock()
+	if h != nil {
+		h(port)
+	}
+}
+
+/* Switching */
+
+// SwitchResult says how far a successful switch was confirmed.
+type SwitchResult int
+
+const (
+	Switched   SwitchResult = iota // command sent; no read-back requested
+	Verified                       // read-back confirmed the new input
+	Unverified                     // read-back did not confirm it (yet)
+)
+
+// Switch selects port, pre-empting any in-flight poll. With verify it reads
+// the active input back a couple of times to confirm the change. source
+// (one of the schema.Source values) is reported with the input_changed event
+// once the change is confirmed, and with input_requested until then.
+func (d *Device) Switch(port int, verify bool, source string) (SwitchResult, error) {
+	return d.SwitchContext(d.Context(), port, verify, source)
+}
+
+// SwitchContext is Switch bounded by ctx instead of the poller's lifetime.
+func (d *Device) SwitchContext(ctx context.Context, port int, verify bool, source string) (SwitchResult, error) {
+	d.BeginPending(port, d.Suppress())
+	d.AbortPoll()
+	if err := d.Cli.SetInputContext(ctx, port); err != nil {
+		d.BeginPending(0, 0)
+		return Switched, err
+	}
+	d.stateMu.Lock()
+	if d.switches == nil {
+		d.switches = map[int]uint64{}
+	}
+	d.switches[port]++
+	d.stateMu.Unlock()
+	if !verify {
+		// Nothing confirmed the switch yet; the next poll or push that
+		// reports port announces the change on behalf of source.
+		d.requested(port, source)
+		return Switched, nil
+	}
+	// Only a confirmed change is announced; if the read-back disagrees, the
+	// next poll reports whatever the switch settled on.
+	for attempt := 0; attempt < 2; attempt++ {
+		time.Sleep(90 * time.Millisecond)
+		if cur, err := d.Cli.GetActiveInputContext(ctx); err == nil && cur == port {
+			d.observe(port, d.settle(port, source))
+			return Verified, nil
+		}
+	}
+	d.requested(port, source)
+	return Unverified, nil
+}
+
+/* Pending window */
+
+// SetSuppress sets how long polls that disagree with a just-requested input
+// are ignored, to avoid the highlight flickering back.
+func (d *Device) SetSuppress(dur time.Duration) {
+	d.pendingMu.Lock()
+	d.suppress = dur
+	d.pendingMu.Unlock()
+}
+
+func (d *Device) Suppress() time.Duration {
+	d.pendingMu.Lock()
+	defer d.pendingMu.Unlock()
+	return d.suppress
+}
+
+// BeginPending makes polls that disagree with port be ignored for dur.
+func (d *Device) BeginPending(port int, dur time.Duration) {
+	d.pendingMu.Lock()
+	d.pendingPort = port
+	d.pendingUntil = time.Now().Add(dur)
+	d.pendingSource = ""
+	d.pendingMu.Unlock()
+}
+func (d *Device) shouldIgnore(polled int) bool {
+	d.pendingMu.Lock()
+	defer d.pendingMu.Unlock()
+	if time.Now().After(d.pendingUntil) {
+		return false
+	}
+	return polled != d.pendingPort
+}
+
+// settle ends the pending window if polled is the requested input. It
+// returns the source to report polled with: that of an unverified switch it
+// confirms, otherwise fallback. Either way the request is settled.
+func (d *Device) settle(polled int, fallback string) string {
+	d.pendingMu.Lock()
+	defer d.pendingMu.Unlock()
+	source := fallback
+	if polled == d.pendingPort {
+		d.pendingUntil = time.Time{}
+		if d.pendingSource != "" {
+			source = d.pendingSource
+		}
+	}
+	d.pendingSource = ""
+	return source
+}
+
+// requested records an unverified switch to port and announces the request.
+func (d *Device) requested(port int, source string) {
+	d.pendingMu.Lock()
+	d.pendingSource = source
+	d.pendingMu.Unlock()
+	d.Events.Publish(schema.Event{
+		Type:   schema.EventInputRequested,
+		Device: d.Name(),
+		Source: source,
+		Input:  &schema.Input{Port: port, Name: d.Config().InputName(port)},
+	})
+}
+
+/* State + events */
+
+// State returns a snapshot of what the device last learned.
+func (d *Device) State() State {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+	return d.state
+}
+
+// SwitchCounts returns how often each port was switched to successfully.
+func (d *Device) SwitchCounts() map[int]uint64 {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+	out := make(map[int]uint64, len(d.switches))
+	for p, n := range d.switches {
+		out[p] = n
+	}
+	return out
+}
+
+// observe records port as active and announces a change.
+func (d *Device) observe(port int, source string) {
+	d.stateMu.Lock()
+	prev := d.state
+	d.state.Active, d.state.Online, d.state.Err, d.state.Updated = port, true, nil, time.Now()
+	d.state.Link, d.state.Failures, d.state.Backoff = LinkOnline, 0, 0
+	d.stateMu.Unlock()
+	if !prev.Online && prev.Err != nil {
+		d.Events.Publish(schema.Event{Type: schema.EventPollRecovered, Device: d.Name()})
+	}
+	if prev.Link == LinkOffline {
+		d.resume()
+	}
+	d.linkChanged(prev.Link, LinkOnline)
+	if port != prev.Active {
+		c := d.Config()
+		e := schema.Event{
+			Type:   schema.EventInputChanged,
+			Device: d.Name(),
+			Source: source,
+			Input:  &schema.Input{Port: port, Name: c.InputName(port)},
+		}
+		if prev.Active > 0 {
+			e.Previous = &schema.Input{Port: prev.Active, Name: c.InputName(prev.Active)}
+		}
+		d.Events.Publish(e)
+	}
+}
+
+// fail records a poll failure; only the first of a run is announced.
+func (d *Device) fail(err error) {
+	d.stateMu.Lock()
+	prev := d.state.Link
+	wasOnline := d.state.Online || d.state.Err == nil
+	d.state.Online, d.state.Err, d.state.Updated = false, err, time.Now()
+	d.state.PollsFailed++
+	d.state.Failures++
+	d.state.Link = LinkDegraded
+	if n := d.state.Failures - OfflineAfter; n >= 0 {
+		d.state.Link = LinkOffline
+		c := d.Config()
+		d.state.Backoff = c.PollInterval() << min(n+1, 16)
+		if limit := c.PollBackoffMax(); d.state.Backoff > limit {
+			d.state.Backoff = limit
+		}
+	}
+	link := d.state.Link
+	d.stateMu.Unlock()
+	if wasOnline {
+		d.Events.Publish(schema.Event{Type: schema.EventPollFailed, Device: d.Name(), Error: schema.NewError(err)})
+	}
+	d.linkChanged(prev, link)
+}
+
+// linkChanged announces a transition of the link state.
+func (d *Device) linkChanged(from, to Link) {
+	if from == to {
+		return
+	}
+	d.Events.Publish(schema.Event{Type: schema.EventLinkChanged, Device: d.Name(), Link: to.String()})
+	d.mu.Lock()
+	h := d.handlers.OnLink
+	d.mu.Unlock()
+	if h != nil {
+		h(from, to)
+	}
+}
@@ -0,0 +1,195 @@
+package device_test
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+	"github.com/SiirRandall/tesmart-ui/internal/events"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+	"github.com/SiirRandall/tesmart-ui/internal/simulator"
+)
+
+func TestSetConfig(t *testing.T) {
+	m, _ := config.LookupModel(config.DefaultModel)
+	entry := config.DefaultDevice(m)
+	d := device.New(entry, time.Second)
+	defer d.Close()
+
+	snap := d.Config()
+	edit := d.Config()
+	edit.Name = "Rack"
+	edit.Ports[1] = config.PortMeta{Name: "Desk"}
+	if snap.Name == "Rack" || snap.InputName(1) == "Desk" {
+		t.Fatal("editing one snapshot changed another")
+	}
+	d.SetConfig(edit)
+	if d.Name() != "Rack" || d.Config().InputName(1) != "Desk" {
+		t.Fatalf("SetConfig not applied: %q, %q", d.Name(), d.Config().InputName(1))
+	}
+	if entry.Name != "Rack" {
+		t.Error("the config entry the device was built from was not updated")
+	}
+	if snap.Name == "Rack" {
+		t.Error("SetConfig changed an earlier snapshot")
+	}
+
+	// Readers and SetConfig may run concurrently (go test -race).
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				if i%2 == 0 {
+					d.SetConfig(d.Config())
+				} else {
+					_ = d.Config().InputName(1) + d.Name()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Saving the config file reads the entries that SetConfig writes.
+func TestSetConfigSave(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := device.New(cfg.Devices[0], time.Second)
+	defer d.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 200 {
+			c := d.Config()
+			c.Name = fmt.Sprint("Rack ", i)
+			c.Ports[1] = config.PortMeta{Name: c.Name}
+			d.SetConfig(c)
+		}
+	}()
+	for range 50 {
+		if err := cfg.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dc := saved.Devices[0]; dc.Name != "Rack 199" || dc.InputName(1) != dc.Name {
+		t.Fatalf("saved %q with input 1 named %q", dc.Name, dc.InputName(1))
+	}
+}
+
+func newSwitch(t *testing.T, bus *events.Bus) (*simulator.Device, *device.Device) {
+	t.Helper()
+	st := simulator.DefaultState()
+	st.Active = 3
+	sim := simulator.New(st)
+	sim.Logf = func(string, ...any) {}
+	if err := sim.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sim.Close() })
+	m, _ := config.LookupModel(config.DefaultModel)
+	cfg := config.DefaultDevice(m)
+	addr := sim.Addr().(*net.TCPAddr)
+	cfg.Name, cfg.IP, cfg.Port = "Rack", addr.IP.String(), addr.Port
+	d := device.New(cfg, time.Second)
+	d.Events = bus
+	t.Cleanup(d.Close)
+	return sim, d
+}
+
+// published returns what was published after seq after, as "type source port".
+func published(bus *events.Bus, after uint64) []string {
+	backlog, _, cancel := bus.Subscribe(after)
+	cancel()
+	var out []string
+	for _, e := range backlog {
+		if e.Input != nil {
+			out = append(out, fmt.Sprintf("%s %s %d", e.Type, e.Source, e.Input.Port))
+		}
+	}
+	return out
+}
+
+func lastSeq(bus *events.Bus) uint64 {
+	backlog, _, cancel := bus.Subscribe(0)
+	cancel()
+	if len(backlog) == 0 {
+		return 0
+	}
+	return backlog[len(backlog)-1].Seq
+}
+
+// A switch without read-back is only a request; the poll that sees it
+// reports the change, on behalf of whoever asked.
+func TestSwitchUnverified(t *testing.T) {
+	bus := events.NewBus(64)
+	sim, d := newSwitch(t, bus)
+	d.PollOnce()
+
+	seq := lastSeq(bus)
+	if _, err := d.Switch(5, false, schema.SourceAPI); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := published(bus, seq), []string{"input_requested api 5"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("after switching: %v, want %v", got, want)
+	}
+	if got := d.State().Active; got != 3 {
+		t.Fatalf("unconfirmed input %d recorded as active", got)
+	}
+
+	d.PollOnce()
+	_ = sim.SetActive(7) // front panel
+	d.PollOnce()
+	want := []string{"input_requested api 5", "input_changed api 5", "input_changed poll 7"}
+	if got := published(bus, seq); !reflect.DeepEqual(got, want) {
+		t.Fatalf("after polling: %v, want %v", got, want)
+	}
+
+	seq = lastSeq(bus)
+	if r, err := d.Switch(2, true, schema.SourceMQTT); err != nil || r != device.Verified {
+		t.Fatalf("verified switch: %v, %v", r, err)
+	}
+	if got, want := published(bus, seq), []string{"input_changed mqtt 2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("after a verified switch: %v, want %v", got, want)
+	}
+}
+
+// A config reload sets the suppress window while other front ends switch
+// (go test -race).
+func TestSetSuppress(t *testing.T) {
+	_, d := newSwitch(t, nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 100 {
+			d.SetSuppress(time.Duration(i) * time.Millisecond)
+		}
+	}()
+	for _, port := range []int{1, 2, 3} {
+		if _, err := d.Switch(port, false, schema.SourceAPI); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	if got := d.Suppress(); got != 99*time.Millisecond {
+		t.Fatalf("Suppress() = %v", got)
+	}
+}
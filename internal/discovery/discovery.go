@@ -0,0 +1,220 @@
+// Package discovery finds TESmart switches on the LAN by sending the
+// active-input query to every host of a subnet.
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/protocol"
+)
+
+// Result is one switch that answered the probe.
+type Result struct {
+	IP      string
+	Port    int
+	Active  int // 1-based input reported by the switch
+	Latency time.Duration
+}
+
+func (r Result) Addr() string { return net.JoinHostPort(r.IP, strconv.Itoa(r.Port)) }
+
+type Options struct {
+	Port    int           // TCP port to probe; 5000 if zero
+	Timeout time.Duration // per-host dial + reply budget; 400ms if zero
+	Workers int           // concurrent probes; 64 if zero
+
+	OnResult   func(Result)          // called as switches answer
+	OnProgress func(done, total int) // called after every probed host
+}
+
+// MaxHosts bounds a single scan; larger prefixes are rejected.
+const MaxHosts = 1 << 16
+
+// Scan probes every host address in the given prefixes (comma or space
+// separated CIDRs, or bare IPv4 addresses) and returns the switches that
+// replied, ordered by address.
+func Scan(ctx context.Context, cidrs string, opt Options) ([]Result, error) {
+	if opt.Port == 0 {
+		opt.Port = 5000
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = 400 * time.Millisecond
+	}
+	if opt.Workers <= 0 {
+		opt.Workers = 64
+	}
+	hosts, err := expand(cidrs)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu      sync.Mutex
+		results []Result
+		done    int
+		wg      sync.WaitGroup
+	)
+	jobs := make(chan netip.Addr)
+	for i := 0; i < opt.Workers && i < len(hosts); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := range jobs {
+				r, err := Probe(ctx, ip.String(), opt.Port, opt.Timeout)
+				mu.Lock()
+				done++
+				n := done
+				if err == nil {
+					results = append(results, r)
+				}
+				mu.Unlock()
+				if err == nil && opt.OnResult != nil {
+					opt.OnResult(r)
+				}
+				if opt.OnProgress != nil {
+					opt.OnProgress(n, len(hosts))
+				}
+			}
+		}()
+	}
+feed:
+	for _, ip := range hosts {
+		select {
+		case jobs <- ip:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		a, _ := netip.ParseAddr(results[i].IP)
+		b, _ := netip.ParseAddr(results[j].IP)
+		return a.Less(b)
+	})
+	return results, ctx.Err()
+}
+
+// ErrNotTESmart is returned by Probe when a host accepted the connection but
+// did not answer with an active-input frame.
+var ErrNotTESmart = errors.New("no TESmart reply")
+
+// Probe sends the active-input query (AA BB 03 10 00 EE) to ip:port and
+// waits for an AA BB 03 11 xx EE reply.
+func Probe(ctx context.Context, ip string, port int, timeout time.Duration) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if _, err := conn.Write(protocol.Encode(protocol.QueryActive{})); err != nil {
+		return Result{}, err
+	}
+	var dec protocol.Decoder
+	tmp := make([]byte, 64)
+	for read := 0; read < 256; {
+		n, err := conn.Read(tmp)
+		read += n
+		for _, f := range dec.Feed(tmp[:n]) {
+			if st, ok := f.Status(); ok {
+				return Result{IP: ip, Port: port, Active: st.Active, Latency: time.Since(start)}, nil
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	return Result{}, ErrNotTESmart
+}
+
+/* Address ranges */
+
+// LocalSubnets lists the IPv4 networks of the host's up, non-loopback
+// interfaces. Networks wider than /22 are narrowed to the host's /24 so
+// the default scan stays quick.
+func LocalSubnets() []string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var out []string
+	seen := map[string]bool{}
+	for _, ifc := range ifaces {
+		if ifc.Flags&net.FlagUp == 0 || ifc.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, _ := ifc.Addrs()
+		for _, a := range addrs {
+			ipn, ok := a.(*net.IPNet)
+			if !ok || ipn.IP.To4() == nil || ipn.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			bits, _ := ipn.Mask.Size()
+			if bits < 22 {
+				bits = 24
+			}
+			addr, _ := netip.AddrFromSlice(ipn.IP.To4())
+			p := netip.PrefixFrom(addr, bits).Masked().String()
+			if !seen[p] {
+				seen[p] = true
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
+
+// expand turns the user's ranges into host addresses, skipping network and
+// broadcast addresses of prefixes shorter than /31.
+func expand(cidrs string) ([]netip.Addr, error) {
+	fields := strings.FieldsFunc(cidrs, func(r rune) bool { return r == ',' || r == ' ' || r == ';' })
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no subnet to scan")
+	}
+	var hosts []netip.Addr
+	for _, f := range fields {
+		if !strings.Contains(f, "/") {
+			a, err := netip.ParseAddr(f)
+			if err != nil || !a.Is4() {
+				return nil, fmt.Errorf("invalid IPv4 address %q", f)
+			}
+			hosts = append(hosts, a)
+			continue
+		}
+		p, err := netip.ParsePrefix(f)
+		if err != nil || !p.Addr().Is4() {
+			return nil, fmt.Errorf("invalid IPv4 subnet %q", f)
+		}
+		p = p.Masked()
+		size := 1 << (32 - p.Bits())
+		if len(hosts)+size > MaxHosts {
+			return nil, fmt.Errorf("subnet %s is too large (at most %d hosts per scan)", p, MaxHosts)
+		}
+		a := p.Addr()
+		for i := 0; i < size; i++ {
+			if size <= 2 || (i != 0 && i != size-1) {
+				hosts = append(hosts, a)
+			}
+			a = a.Next()
+		}
+	}
+	return hosts, nil
+}
@@ -0,0 +1,77 @@
+// Package events fans out switch events (input changes, poll failures,
+// config edits) to any number of subscribers, keeping a short history so a
+// subscriber that reconnects can catch up.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+)
+
+// Bus is safe for concurrent use. A nil *Bus drops everything published.
+type Bus struct {
+	mu   sync.Mutex
+	seq  uint64
+	ring []schema.Event // the last len(ring) events, oldest first
+	size int
+	subs map[chan schema.Event]struct{}
+}
+
+// NewBus keeps the last size events for resuming subscribers.
+func NewBus(size int) *Bus {
+	return &Bus{size: size, subs: map[chan schema.Event]struct{}{}}
+}
+
+// Publish stamps e with the next sequence number and the current time and
+// delivers it. Subscribers that are not keeping up are dropped; they can
+// resubscribe from the last Seq they saw.
+func (b *Bus) Publish(e schema.Event) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	e.Version, e.Seq, e.Time = schema.Version, b.seq, time.Now()
+	if len(b.ring) == b.size {
+		b.ring = append(b.ring[:0], b.ring[1:]...)
+	}
+	b.ring = append(b.ring, e)
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns the retained events after seq after, then a channel of
+// new ones. An after beyond the current sequence (e.g. from before a
+// restart) replays the whole history. The channel is closed by cancel, or
+// when the subscriber falls behind.
+func (b *Bus) Subscribe(after uint64) (backlog []schema.Event, ch <-chan schema.Event, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if after > b.seq {
+		after = 0
+	}
+	for _, e := range b.ring {
+		if e.Seq > after {
+			backlog = append(backlog, e)
+		}
+	}
+	c := make(chan schema.Event, 64)
+	b.subs[c] = struct{}{}
+	return backlog, c, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[c]; ok {
+			delete(b.subs, c)
+			close(c)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package events_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/SiirRandall/tesmart-ui/internal/events"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+)
+
+func seqs(es []schema.Event) []uint64 {
+	var s []uint64
+	for _, e := range es {
+		s = append(s, e.Seq)
+	}
+	return s
+}
+
+func publish(b *events.Bus, n int) {
+	for range n {
+		b.Publish(schema.Event{Type: schema.EventInputChanged, Device: "Rack"})
+	}
+}
+
+func TestSubscribeAfterWrap(t *testing.T) {
+	b := events.NewBus(4)
+	publish(b, 6) // the ring now holds 3..6
+
+	for _, tc := range []struct {
+		after uint64
+		want  []uint64
+	}{
+		{0, []uint64{3, 4, 5, 6}},
+		{1, []uint64{3, 4, 5, 6}}, // 2 is gone; resume from the oldest kept
+		{4, []uint64{5, 6}},
+		{6, nil},
+		{99, []uint64{3, 4, 5, 6}}, // a sequence from before a restart
+	} {
+		backlog, _, cancel := b.Subscribe(tc.after)
+		cancel()
+		if got := seqs(backlog); !slices.Equal(got, tc.want) {
+			t.Errorf("Subscribe(%d) = %v, want %v", tc.after, got, tc.want)
+		}
+	}
+
+	backlog, ch, cancel := b.Subscribe(5)
+	defer cancel()
+	publish(b, 1)
+	if got := seqs(backlog); len(got) != 1 || got[0] != 6 {
+		t.Fatalf("backlog %v, want [6]", got)
+	}
+	if e := <-ch; e.Seq != 7 || e.Version != schema.Version {
+		t.Fatalf("got seq %d version %d, want 7 %d", e.Seq, e.Version, schema.Version)
+	}
+}
+
+func TestSlowSubscriberDropped(t *testing.T) {
+	b := events.NewBus(128)
+	_, ch, cancel := b.Subscribe(0)
+	_, fast, cancelFast := b.Subscribe(0)
+	defer cancelFast()
+
+	// The slow subscriber never reads; the fast one keeps up.
+	var last uint64
+	for range 100 {
+		publish(b, 1)
+		last = (<-fast).Seq
+	}
+	var got []schema.Event
+	for e := range ch { // closed once it fell behind
+		got = append(got, e)
+	}
+	cancel() // a no-op once dropped
+	if len(got) == 0 || got[0].Seq != 1 || got[len(got)-1].Seq >= last {
+		t.Fatalf("slow subscriber got %v, want 1.. and dropped before %d", seqs(got), last)
+	}
+
+	// It resumes from the last event it saw.
+	backlog, _, cancel := b.Subscribe(got[len(got)-1].Seq)
+	defer cancel()
+	if s := seqs(backlog); len(s) == 0 || s[0] != got[len(got)-1].Seq+1 || s[len(s)-1] != last {
+		t.Fatalf("resumed with %v, want %d..%d", s, got[len(got)-1].Seq+1, last)
+	}
+}
@@ -0,0 +1,262 @@
+// Package history keeps an append-only log of input changes, one JSON object
+// per line, and sums up how long each input was selected.
+package history
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/events"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+)
+
+// File is the log's name in the config directory.
+const File = "history.jsonl"
+
+// SourceStop marks the end of what is known about a switch: tesmart-ui
+// stopped or the switch was removed.
+const SourceStop = "stop"
+
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Device string    `json:"device"`
+	Port   int       `json:"port"` // 0 with SourceStop
+	Name   string    `json:"name,omitempty"`
+	Source string    `json:"source"`
+}
+
+/* Recording */
+
+// Recorder appends the input_changed events of a bus to the log.
+type Recorder struct {
+	path   string
+	events *events.Bus
+	done   chan struct{}
+
+	mu      sync.Mutex
+	current map[string]int // device → port of its last entry
+}
+
+func NewRecorder(dir string, bus *events.Bus) *Recorder {
+	return &Recorder{
+		path:    filepath.Join(dir, File),
+		events:  bus,
+		done:    make(chan struct{}),
+		current: map[string]int{},
+	}
+}
+
+func (r *Recorder) Start() { go r.follow() }
+
+// Close stops recording and marks every switch as stopped, so the time
+// until the next start is not counted for its last input.
+func (r *Recorder) Close() {
+	close(r.done)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var stops []Entry
+	for dev, port := range r.current {
+		if port != 0 {
+			stops = append(stops, Entry{Time: now, Device: dev, Source: SourceStop})
+		}
+	}
+	r.append(stops...)
+}
+
+func (r *Recorder) follow() {
+	// Changes from before the start are history already.
+	past, ch, cancel := r.events.Subscribe(0)
+	var last uint64
+	if len(past) > 0 {
+		last = past[len(past)-1].Seq
+	}
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				var backlog []schema.Event
+				backlog, ch, cancel = r.events.Subscribe(last)
+				for _, e := range backlog {
+					last = e.Seq
+					r.handle(e)
+				}
+				continue
+			}
+			last = e.Seq
+			r.handle(e)
+		case <-r.done:
+			cancel()
+			return
+		}
+	}
+}
+
+func (r *Recorder) handle(e schema.Event) {
+	var ent Entry
+	switch {
+	case e.Type == schema.EventInputChanged:
+		ent = Entry{Time: e.Time, Device: e.Device, Port: e.Input.Port, Name: e.Input.Name, Source: e.Source}
+	case e.Type == schema.EventConfigChanged && e.What == "removed":
+		ent = Entry{Time: e.Time, Device: e.Device, Source: SourceStop}
+	default:
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.done:
+		return // Close has written the stop entries
+	default:
+	}
+	if ent.Port == 0 && r.current[ent.Device] == 0 {
+		return
+	}
+	r.current[ent.Device] = ent.Port
+	r.append(ent)
+}
+
+func (r *Recorder) append(entries ...Entry) {
+	if len(entries) == 0 {
+		return
+	}
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		log.Printf("[history] %v", err)
+		return
+	}
+	defer f.Close()
+	var b []byte
+	for _, e := range entries {
+		line, _ := json.Marshal(e)
+		b = append(append(b, line...), '\n')
+	}
+	if _, err := f.Write(b); err != nil {
+		log.Printf("[history] %v", err)
+	}
+}
+
+/* Reading */
+
+// Load reads the log in dir, oldest first. A missing log is empty; lines
+// that don't parse (e.g. cut short by a crash) are skipped.
+func Load(dir string) ([]Entry, error) {
+	f, err := os.Open(filepath.Join(dir, File))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []Entry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e Entry
+		if json.Unmarshal(sc.Bytes(), &e) == nil && !e.Time.IsZero() {
+			out = append(out, e)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out, sc.Err()
+}
+
+// Total is how long one input was selected.
+type Total struct {
+	Device string
+	Port   int
+	Name   string // the most recent name seen
+	Time   time.Duration
+}
+
+// Dwell sums, per switch and input, the time within [from, to) that each
+// input was selected, longest first. The last entry of a switch counts up
+// to to, so pass the current time to include the input selected now.
+func Dwell(entries []Entry, from, to time.Time) []Total {
+	type key struct {
+		dev  string
+		port int
+	}
+	// Each entry lasts until the switch's next one.
+	ends := make([]time.Time, len(entries))
+	next := map[string]time.Time{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		ends[i] = to
+		if t, ok := next[e.Device]; ok {
+			ends[i] = t
+		}
+		next[e.Device] = e.Time
+	}
+	sums := map[key]*Total{}
+	for i, e := range entries {
+		if e.Port == 0 {
+			continue
+		}
+		start, end := e.Time, ends[i]
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		k := key{e.Device, e.Port}
+		t := sums[k]
+		if t == nil {
+			t = &Total{Device: e.Device, Port: e.Port}
+			sums[k] = t
+		}
+		t.Name = e.Name
+		if end.After(start) {
+			t.Time += end.Sub(start)
+		}
+	}
+	out := make([]Total, 0, len(sums))
+	for _, t := range sums {
+		if t.Time > 0 {
+			out = append(out, *t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Time != out[j].Time {
+			return out[i].Time > out[j].Time
+		}
+		if out[i].Device != out[j].Device {
+			return out[i].Device < out[j].Device
+		}
+		return out[i].Port < out[j].Port
+	})
+	return out
+}
+
+/* Export */
+
+func WriteJSON(w io.Writer, entries []Entry) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if entries == nil {
+		entries = []Entry{}
+	}
+	return enc.Encode(entries)
+}
+
+func WriteCSV(w io.Writer, entries []Entry) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"time", "device", "port", "name", "source"})
+	for _, e := range entries {
+		_ = cw.Write([]string{e.Time.Format(time.RFC3339), e.Device, strconv.Itoa(e.Port), e.Name, e.Source})
+	}
+	cw.Flush()
+	return cw.Error()
+}
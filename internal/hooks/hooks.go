@@ -0,0 +1,158 @@
+// Package hooks runs the user's on_enter/on_leave commands when a switch's
+// active input changes.
+//
+// Commands run through the shell (sh -c, or cmd /C on Windows) with:
+//
+//	TESMART_EVENT     enter or leave
+//	TESMART_DEVICE    switch name
+//	TESMART_SOURCE    what caused the change: poll, ui, tray, api, cli, ...
+//	TESMART_OLD_PORT  previous input, and its name in
+//	TESMART_OLD_NAME
+//	TESMART_NEW_PORT  new input, and its name in
+//	TESMART_NEW_NAME
+//
+// Output is written to the log. Leave hooks of the old input run before
+// enter hooks of the new one; per-port hooks run before the global ones.
+// The first input seen after a start or reconnect is no change, so it runs
+// nothing.
+package hooks
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/events"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+)
+
+// Runner follows input_changed events and runs the configured hooks one
+// event at a time, so the commands of a change finish before the next
+// change's start.
+type Runner struct {
+	cfg    *config.Config
+	events *events.Bus
+	done   chan struct{}
+
+	mu      sync.Mutex
+	global  config.Hooks
+	timeout time.Duration
+}
+
+func New(cfg *config.Config, bus *events.Bus) *Runner {
+	r := &Runner{cfg: cfg, events: bus, done: make(chan struct{})}
+	r.Reload()
+	return r
+}
+
+// Reload picks up edits to the global hooks and hook_timeout_ms. Per-port
+// hooks are read from the switch's entry at each change.
+func (r *Runner) Reload() {
+	r.mu.Lock()
+	r.global, r.timeout = r.cfg.Hooks, r.cfg.HookTimeout()
+	r.mu.Unlock()
+}
+
+// Start follows the changes from now on; those before it are history, not
+// news.
+func (r *Runner) Start() {
+	past, ch, cancel := r.events.Subscribe(0)
+	var last uint64
+	if len(past) > 0 {
+		last = past[len(past)-1].Seq
+	}
+	go r.follow(last, ch, cancel)
+}
+
+// Close stops taking new events; a hook already running finishes or times out.
+func (r *Runner) Close() { close(r.done) }
+
+func (r *Runner) follow(last uint64, ch <-chan schema.Event, cancel func()) {
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				// Fell behind while a hook ran; catch up from the history.
+				var backlog []schema.Event
+				backlog, ch, cancel = r.events.Subscribe(last)
+				for _, e := range backlog {
+					last = e.Seq
+					r.handle(e)
+				}
+				continue
+			}
+			last = e.Seq
+			r.handle(e)
+		case <-r.done:
+			cancel()
+			return
+		}
+	}
+}
+
+func (r *Runner) handle(e schema.Event) {
+	if e.Type != schema.EventInputChanged || e.Previous == nil {
+		return
+	}
+	live := r.cfg.Device(e.Device)
+	if live == nil {
+		return
+	}
+	dc := live.Snapshot()
+	r.mu.Lock()
+	global, timeout := r.global, r.timeout
+	r.mu.Unlock()
+	env := []string{
+		"TESMART_DEVICE=" + e.Device,
+		"TESMART_SOURCE=" + e.Source,
+		"TESMART_NEW_PORT=" + strconv.Itoa(e.Input.Port),
+		"TESMART_NEW_NAME=" + e.Input.Name,
+		"TESMART_OLD_PORT=" + strconv.Itoa(e.Previous.Port),
+		"TESMART_OLD_NAME=" + e.Previous.Name,
+	}
+	r.run("leave", dc.Ports[e.Previous.Port].OnLeave, env, timeout)
+	r.run("leave", global.OnLeave, env, timeout)
+	r.run("enter", dc.Ports[e.Input.Port].OnEnter, env, timeout)
+	r.run("enter", global.OnEnter, env, timeout)
+}
+
+func (r *Runner) run(event, command string, env []string, timeout time.Duration) {
+	if command == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = append(append(os.Environ(), "TESMART_EVENT="+event), env...)
+	cmd.WaitDelay = time.Second // don't wait on children that keep the pipes open
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+
+	start := time.Now()
+	err := cmd.Run()
+	sc := bufio.NewScanner(&out)
+	for sc.Scan() {
+		log.Printf("[hook] %s: %s", event, sc.Text())
+	}
+	switch {
+	case ctx.Err() != nil:
+		log.Printf("[hook] %s %q: killed after %v", event, command, timeout)
+	case err != nil:
+		log.Printf("[hook] %s %q: %v", event, command, err)
+	default:
+		log.Printf("[hook] %s %q: ok in %v", event, command, time.Since(start).Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,74 @@
+//go:build unix
+
+package hooks_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/events"
+	"github.com/SiirRandall/tesmart-ui/internal/hooks"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+)
+
+func changed(from, to int) schema.Event {
+	e := schema.Event{Type: schema.EventInputChanged, Device: "Rack", Source: schema.SourcePoll,
+		Input: &schema.Input{Port: to, Name: "Port " + strconv.Itoa(to)}}
+	if from != 0 {
+		e.Previous = &schema.Input{Port: from, Name: "Port " + strconv.Itoa(from)}
+	}
+	return e
+}
+
+// lines waits for the log to hold n lines, and a little longer for any
+// that should not be there, and returns them with spaces as underscores.
+func lines(path string, n int) []string {
+	read := func() []string {
+		b, _ := os.ReadFile(path)
+		return strings.Fields(strings.ReplaceAll(string(b), " ", "_"))
+	}
+	for deadline := time.Now().Add(5 * time.Second); len(read()) < n && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	return read()
+}
+
+func TestRunner(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "hooks.log")
+	t.Setenv("HOOK_LOG", log)
+	record := `echo "$TESMART_EVENT $TESMART_OLD_PORT $TESMART_NEW_PORT" >> "$HOOK_LOG"`
+
+	m, _ := config.LookupModel(config.DefaultModel)
+	dc := config.DefaultDevice(m)
+	dc.Name = "Rack"
+	dc.Ports[2] = config.PortMeta{Name: "Desk", Hooks: config.Hooks{OnEnter: `echo "desk" >> "$HOOK_LOG"`}}
+	cfg := &config.Config{Devices: []*config.Device{dc}, HookTimeoutMs: 5000, Hooks: config.Hooks{OnEnter: record}}
+
+	bus := events.NewBus(16)
+	r := hooks.New(cfg, bus)
+	r.Start()
+	defer r.Close()
+
+	// The input found at startup is no change.
+	bus.Publish(changed(0, 1))
+	bus.Publish(changed(1, 2))
+	want := []string{"desk", "enter_1_2"}
+	if got := lines(log, len(want)); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("ran %v, want %v", got, want)
+	}
+
+	// Edited hooks apply after Reload.
+	cfg.Hooks = config.Hooks{OnLeave: record}
+	r.Reload()
+	bus.Publish(changed(2, 3))
+	want = append(want, "leave_2_3")
+	if got := lines(log, len(want)); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("ran %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,216 @@
+// Package metrics serves device health in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/client"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+)
+
+// Buckets of the latency histograms, in seconds.
+var Buckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+const (
+	opGetActive = "get_active_input"
+	opSetInput  = "set_input"
+)
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative; last is +Inf
+	sum    float64
+	total  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(Buckets, v)
+	if h.counts == nil {
+		h.counts = make([]uint64, len(Buckets)+1)
+	}
+	h.counts[i]++
+	h.sum += v
+	h.total++
+}
+
+// deviceStats are the measurements reported by a device's client.
+type deviceStats struct {
+	latency map[string]*histogram // by op
+	retries map[string]uint64     // by client.Retry* kind
+}
+
+// Collector gathers client measurements and reads poll state from the
+// devices at scrape time. It is an http.Handler for /metrics.
+type Collector struct {
+	mu    sync.Mutex
+	devs  []*device.Device
+	stats map[*device.Device]*deviceStats
+}
+
+func New(devs []*device.Device) *Collector {
+	c := &Collector{stats: map[*device.Device]*deviceStats{}}
+	c.SetDevices(devs)
+	return c
+}
+
+// SetDevices replaces the measured devices and hooks into their clients.
+func (c *Collector) SetDevices(devs []*device.Device) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.devs = devs
+	keep := map[*device.Device]*deviceStats{}
+	for _, d := range devs {
+		if ds, ok := c.stats[d]; ok {
+			keep[d] = ds
+			continue
+		}
+		keep[d] = &deviceStats{latency: map[string]*histogram{}, retries: map[string]uint64{}}
+		c.attach(d)
+	}
+	c.stats = keep
+}
+
+func (c *Collector) attach(d *device.Device) {
+	latency := func(op string) func(time.Duration, error) {
+		return func(took time.Duration, _ error) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if ds := c.stats[d]; ds != nil {
+				h := ds.latency[op]
+				if h == nil {
+					h = &histogram{}
+					ds.latency[op] = h
+				}
+				h.observe(took.Seconds())
+			}
+		}
+	}
+	d.Cli.SetStats(client.Stats{
+		GetActiveInput: latency(opGetActive),
+		SetInput:       latency(opSetInput),
+		Retry: func(kind string) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if ds := c.stats[d]; ds != nil {
+				ds.retries[kind]++
+			}
+		},
+	})
+}
+
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Write(w)
+}
+
+// Write renders every metric in the Prometheus text exposition format.
+func (c *Collector) Write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+
+	family(w, "tesmart_up", "gauge", "1 if the last poll of the switch succeeded.")
+	for _, d := range c.devs {
+		sample(w, "tesmart_up", labels("device", d.Name()), b2f(d.State().Online))
+	}
+
+	family(w, "tesmart_polls_total", "counter", "Polls of the active input, by result.")
+	for _, d := range c.devs {
+		st := d.State()
+		sample(w, "tesmart_polls_total", labels("device", d.Name(), "result", "success"), float64(st.PollsOK))
+		sample(w, "tesmart_polls_total", labels("device", d.Name(), "result", "failure"), float64(st.PollsFailed))
+	}
+
+	family(w, "tesmart_seconds_since_last_successful_poll", "gauge", "Time since a poll last succeeded; +Inf if none has.")
+	for _, d := range c.devs {
+		age := math.Inf(1)
+		if t := d.State().LastPollOK; !t.IsZero() {
+			age = now.Sub(t).Seconds()
+		}
+		sample(w, "tesmart_seconds_since_last_successful_poll", labels("device", d.Name()), age)
+	}
+
+	family(w, "tesmart_active_input", "gauge", "Active input (1-based); 0 until known.")
+	for _, d := range c.devs {
+		sample(w, "tesmart_active_input", labels("device", d.Name()), float64(d.State().Active))
+	}
+
+	family(w, "tesmart_request_duration_seconds", "histogram", "Latency of client calls, including retries.")
+	for _, d := range c.devs {
+		for _, op := range []string{opGetActive, opSetInput} {
+			h := c.stats[d].latency[op]
+			if h == nil {
+				h = &histogram{counts: make([]uint64, len(Buckets)+1)}
+			}
+			base := labels("device", d.Name(), "op", op)
+			var cum uint64
+			for i, le := range Buckets {
+				cum += h.counts[i]
+				sample(w, "tesmart_request_duration_seconds_bucket", base+`,le="`+strconv.FormatFloat(le, 'g', -1, 64)+`"`, float64(cum))
+			}
+			sample(w, "tesmart_request_duration_seconds_bucket", base+`,le="+Inf"`, float64(h.total))
+			sample(w, "tesmart_request_duration_seconds_sum", base, h.sum)
+			sample(w, "tesmart_request_duration_seconds_count", base, float64(h.total))
+		}
+	}
+
+	family(w, "tesmart_retries_total", "counter", "Second attempts: a re-query after an unusable status reply, or the other switch command encoding.")
+	for _, d := range c.devs {
+		for _, kind := range []string{client.RetryGetActive, client.RetrySetFallback} {
+			sample(w, "tesmart_retries_total", labels("device", d.Name(), "kind", kind), float64(c.stats[d].retries[kind]))
+		}
+	}
+
+	family(w, "tesmart_switches_total", "counter", "Successful switches to each input.")
+	for _, d := range c.devs {
+		counts, dc := d.SwitchCounts(), d.Config()
+		for p := 1; p <= dc.PortCount(); p++ {
+			sample(w, "tesmart_switches_total", labels("device", dc.Name, "port", strconv.Itoa(p), "name", dc.InputName(p)), float64(counts[p]))
+		}
+	}
+}
+
+/* Exposition format */
+
+func family(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func sample(w io.Writer, name, labels string, v float64) {
+	fmt.Fprintf(w, "%s{%s} %s\n", name, labels, formatValue(v))
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels renders name/value pairs as `a="x",b="y"`.
+func labels(kv ...string) string {
+	parts := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		parts = append(parts, kv[i]+`="`+labelEscaper.Replace(kv[i+1])+`"`)
+	}
+	return strings.Join(parts, ",")
+}
+
+func b2f(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
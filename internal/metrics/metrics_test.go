@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"bytes"
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/client"
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+	"github.com/SiirRandall/tesmart-ui/internal/simulator"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/*.golden")
+
+func newDevice(t *testing.T, name, addr string) *device.Device {
+	t.Helper()
+	m, _ := config.LookupModel("hdmi-4")
+	cfg := config.DefaultDevice(m)
+	host, port, _ := net.SplitHostPort(addr)
+	cfg.Name, cfg.IP = name, host
+	cfg.Port, _ = strconv.Atoi(port)
+	d := device.New(cfg, time.Second)
+	t.Cleanup(d.Close)
+	return d
+}
+
+// TestWrite records switches, a failed poll and some request latencies, and
+// compares the exposition with testdata/write.golden.
+func TestWrite(t *testing.T) {
+	sim := simulator.New(simulator.DefaultState())
+	sim.Logf = func(string, ...any) {}
+	if err := sim.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sim.Close() })
+	rack := newDevice(t, "Rack", sim.Addr().String())
+	c := rack.Config()
+	c.Ports[2] = config.PortMeta{Name: `Desk "left" \ new` + "\n"}
+	rack.SetConfig(c)
+	for _, p := range []int{2, 2, 4} {
+		if _, err := rack.Switch(p, false, schema.SourceAPI); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing listens on a port just released.
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	gone := ln.Addr().String()
+	_ = ln.Close()
+	lab := newDevice(t, `Lab "B"`, gone)
+	lab.PollOnce()
+
+	col := New([]*device.Device{rack, lab})
+	st := col.stats[rack]
+	for _, v := range []float64{0.003, 0.04, 0.04, 3} {
+		st.latency[opGetActive] = add(st.latency[opGetActive], v)
+	}
+	st.latency[opSetInput] = add(st.latency[opSetInput], 0.25)
+	st.retries[client.RetryGetActive] = 2
+
+	var out bytes.Buffer
+	col.Write(&out)
+	golden := filepath.Join("testdata", "write.golden")
+	if *update {
+		if err := os.WriteFile(golden, out.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("got:\n%s\nwant:\n%s", out.Bytes(), want)
+	}
+}
+
+func add(h *histogram, v float64) *histogram {
+	if h == nil {
+		h = &histogram{}
+	}
+	h.observe(v)
+	return h
+}
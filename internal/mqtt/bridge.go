@@ -0,0 +1,375 @@
+// Package mqtt bridges the configured switches to an MQTT broker, with Home
+// Assistant discovery so each switch shows up as a device with an input
+// select, a buzzer switch and an LED timeout select.
+//
+// Topics, under the configured prefix (default "tesmart"):
+//
+//	<prefix>/bridge/availability  online|offline (last will)
+//	<prefix>/<switch>/availability online|offline, from polling
+//	<prefix>/<switch>/input        name of the active input
+//	<prefix>/<switch>/input/set    input name or number
+//	<prefix>/<switch>/buzzer[/set] ON|OFF
+//	<prefix>/<switch>/led[/set]    off|10s|30s
+//
+// <switch> is the switch's name, lower-cased with anything but letters and
+// digits replaced by "_". Switches whose names reduce to the same level get
+// "_2", "_3", ... in config order.
+package mqtt
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+	"github.com/SiirRandall/tesmart-ui/internal/events"
+	"github.com/SiirRandall/tesmart-ui/internal/protocol"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+)
+
+const (
+	online  = "online"
+	offline = "offline"
+)
+
+// Bridge publishes device state and events and executes commands received on
+// the set topics. Like the HTTP server it does not poll; whoever owns the
+// devices runs their pollers.
+type Bridge struct {
+	root   *config.Config
+	cfg    config.MQTT
+	events *events.Bus
+	cli    paho.Client
+	done   chan struct{}
+
+	mu        sync.Mutex
+	devs      []*device.Device
+	announced map[string]bool   // slugs with a discovery config on the broker
+	settings  map[string]string // buzzer and LED state topics → last value set
+}
+
+// The switch cannot be asked for its buzzer and LED settings, so until they
+// are set through the bridge the factory defaults are reported.
+var factorySettings = map[string]string{"buzzer": "ON", "led": "off"}
+
+func New(cfg *config.Config, devs []*device.Device, bus *events.Bus) *Bridge {
+	b := &Bridge{
+		root:      cfg,
+		cfg:       cfg.MQTT,
+		events:    bus,
+		devs:      devs,
+		announced: map[string]bool{},
+		settings:  map[string]string{},
+		done:      make(chan struct{}),
+	}
+	opts := paho.NewClientOptions().
+		AddBroker(b.cfg.Broker).
+		SetClientID(b.cfg.ClientID).
+		SetUsername(b.cfg.Username).
+		SetPassword(b.cfg.Password).
+		SetWill(b.topic("bridge", "availability"), offline, 1, true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(5 * time.Second).
+		SetOrderMatters(false). // commands talk to the switch; don't block the router
+		SetOnConnectHandler(func(paho.Client) { go b.onConnect() }).
+		SetConnectionLostHandler(func(_ paho.Client, err error) { log.Printf("[mqtt] connection lost: %v", err) })
+	b.cli = paho.NewClient(opts)
+	return b
+}
+
+// Start connects in the background (retrying until the broker is reachable)
+// and follows bus events.
+func (b *Bridge) Start() {
+	b.cli.Connect()
+	go b.follow()
+}
+
+// Close marks the bridge offline and disconnects.
+func (b *Bridge) Close() {
+	close(b.done)
+	if b.cli.IsConnectionOpen() {
+		b.publish(b.topic("bridge", "availability"), offline).WaitTimeout(time.Second)
+	}
+	b.cli.Disconnect(250)
+}
+
+// SetDevices replaces the bridged devices after switches are added or
+// removed, and updates the discovery configs.
+func (b *Bridge) SetDevices(devs []*device.Device) {
+	b.mu.Lock()
+	b.devs = devs
+	b.mu.Unlock()
+	b.announce()
+}
+
+func (b *Bridge) devices() []*device.Device {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.devs
+}
+
+/* Topics */
+
+// Slug turns a switch name into a topic level and entity id.
+func Slug(name string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteByte('_')
+		}
+	}
+	if s := strings.Trim(sb.String(), "_"); s != "" {
+		return s
+	}
+	return "switch"
+}
+
+// slugs assigns each device its topic level, adding a suffix where names
+// reduce to the same slug so topics and unique_ids stay apart.
+func slugs(devs []*device.Device) []string {
+	out := make([]string, len(devs))
+	taken := map[string]bool{}
+	for i, d := range devs {
+		base := Slug(d.Name())
+		s := base
+		for n := 2; taken[s]; n++ {
+			s = base + "_" + strconv.Itoa(n)
+		}
+		taken[s] = true
+		out[i] = s
+	}
+	return out
+}
+
+// slugOf returns the topic level of the named switch.
+func (b *Bridge) slugOf(name string) string {
+	devs := b.devices()
+	for i, s := range slugs(devs) {
+		if devs[i].Name() == name {
+			return s
+		}
+	}
+	return Slug(name)
+}
+
+func (b *Bridge) topic(levels ...string) string {
+	return b.cfg.TopicPrefix + "/" + strings.Join(levels, "/")
+}
+
+func (b *Bridge) publish(topic, payload string) paho.Token {
+	return b.cli.Publish(topic, 1, true, payload)
+}
+
+func (b *Bridge) lookup(slug string) *device.Device {
+	devs := b.devices()
+	for i, s := range slugs(devs) {
+		if s == slug {
+			return devs[i]
+		}
+	}
+	return nil
+}
+
+// setting returns the last buzzer or LED value set on topic, or the factory
+// default.
+func (b *Bridge) setting(topic, object string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if v, ok := b.settings[topic]; ok {
+		return v
+	}
+	return factorySettings[object]
+}
+
+// publishSetting records and publishes a buzzer or LED value that was set.
+func (b *Bridge) publishSetting(topic, v string) {
+	b.mu.Lock()
+	b.settings[topic] = v
+	b.mu.Unlock()
+	b.publish(topic, v)
+}
+
+/* Connection */
+
+func (b *Bridge) onConnect() {
+	log.Printf("[mqtt] connected to %s", b.cfg.Broker)
+	subs := map[string]paho.MessageHandler{
+		b.topic("+", "input", "set"):      b.onInputSet,
+		b.topic("+", "buzzer", "set"):     b.onBuzzerSet,
+		b.topic("+", "led", "set"):        b.onLEDSet,
+		b.cfg.DiscoveryPrefix + "/status": b.onHAStatus,
+	}
+	for t, h := range subs {
+		if tok := b.cli.Subscribe(t, 1, h); tok.WaitTimeout(5*time.Second) && tok.Error() != nil {
+			log.Printf("[mqtt] subscribe %s: %v", t, tok.Error())
+		}
+	}
+	b.publish(b.topic("bridge", "availability"), online)
+	b.announce()
+}
+
+// onHAStatus re-sends discovery when Home Assistant (re)starts.
+func (b *Bridge) onHAStatus(_ paho.Client, m paho.Message) {
+	if string(m.Payload()) == online {
+		b.announce()
+	}
+}
+
+// announce publishes discovery configs and current state for every device
+// and removes the configs of switches that are gone or were renamed.
+func (b *Bridge) announce() {
+	if !b.cli.IsConnectionOpen() {
+		return
+	}
+	devs := b.devices()
+	current := map[string]bool{}
+	for i, slug := range slugs(devs) {
+		current[slug] = true
+		for _, c := range b.discoveryConfigs(devs[i], slug) {
+			b.publish(c.topic, c.payload)
+		}
+		b.publishState(devs[i], slug)
+	}
+	b.mu.Lock()
+	stale := []string{}
+	for slug := range b.announced {
+		if !current[slug] {
+			stale = append(stale, slug)
+		}
+	}
+	b.announced = current
+	b.mu.Unlock()
+	for _, slug := range stale {
+		for _, t := range b.discoveryTopics(slug) {
+			b.publish(t, "") // an empty retained config deletes the entity
+		}
+	}
+}
+
+func (b *Bridge) publishState(d *device.Device, slug string) {
+	st := d.State()
+	if st.Active > 0 {
+		b.publish(b.topic(slug, "input"), d.Config().InputName(st.Active))
+	}
+	avail := offline
+	if st.Online {
+		avail = online
+	}
+	b.publish(b.topic(slug, "availability"), avail)
+	for object := range factorySettings {
+		t := b.topic(slug, object)
+		b.publish(t, b.setting(t, object))
+	}
+}
+
+// follow mirrors bus events to the broker.
+func (b *Bridge) follow() {
+	_, ch, cancel := b.events.Subscribe(0)
+	defer func() { cancel() }()
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				// Fell behind; resync everything from the devices.
+				_, ch, cancel = b.events.Subscribe(0)
+				b.announce()
+				continue
+			}
+			b.onEvent(e)
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *Bridge) onEvent(e schema.Event) {
+	if !b.cli.IsConnectionOpen() {
+		return // onConnect publishes the state
+	}
+	slug := b.slugOf(e.Device)
+	switch e.Type {
+	case schema.EventInputChanged:
+		b.publish(b.topic(slug, "input"), e.Input.Name)
+		b.publish(b.topic(slug, "availability"), online)
+	case schema.EventPollFailed:
+		b.publish(b.topic(slug, "availability"), offline)
+	case schema.EventPollRecovered:
+		b.publish(b.topic(slug, "availability"), online)
+	case schema.EventConfigChanged:
+		b.announce()
+	}
+}
+
+/* Commands */
+
+// deviceFor resolves the <switch> level of a set topic.
+func (b *Bridge) deviceFor(m paho.Message) (*device.Device, string) {
+	levels := strings.Split(strings.TrimPrefix(m.Topic(), b.cfg.TopicPrefix+"/"), "/")
+	d := b.lookup(levels[0])
+	if d == nil {
+		log.Printf("[mqtt] %s: no such switch", m.Topic())
+	}
+	return d, levels[0]
+}
+
+func (b *Bridge) onInputSet(_ paho.Client, m paho.Message) {
+	d, slug := b.deviceFor(m)
+	if d == nil {
+		return
+	}
+	port, err := d.Config().ResolveInput(strings.TrimSpace(string(m.Payload())))
+	if err != nil {
+		log.Printf("[mqtt] %s: %v", m.Topic(), err)
+		return
+	}
+	verify := b.root.VerifySwitch()
+	if _, err := d.Switch(port, verify, schema.SourceMQTT); err != nil {
+		log.Printf("[mqtt] %s: %v", m.Topic(), err)
+		b.publishState(d, slug) // put the select back
+	}
+}
+
+func (b *Bridge) onBuzzerSet(_ paho.Client, m paho.Message) {
+	d, slug := b.deviceFor(m)
+	if d == nil {
+		return
+	}
+	v := strings.ToUpper(strings.TrimSpace(string(m.Payload())))
+	if v != "ON" && v != "OFF" {
+		log.Printf("[mqtt] %s: want ON or OFF, not %q", m.Topic(), v)
+		return
+	}
+	if err := d.Cli.SetBuzzerContext(d.Context(), v == "ON"); err != nil {
+		log.Printf("[mqtt] %s: %v", m.Topic(), err)
+		return
+	}
+	b.publishSetting(b.topic(slug, "buzzer"), v)
+}
+
+func (b *Bridge) onLEDSet(_ paho.Client, m paho.Message) {
+	d, slug := b.deviceFor(m)
+	if d == nil {
+		return
+	}
+	v := strings.TrimSpace(string(m.Payload()))
+	mode, ok := protocol.ParseLEDTimeout(v)
+	if !ok {
+		log.Printf("[mqtt] %s: want off, 10s or 30s, not %q", m.Topic(), v)
+		return
+	}
+	if err := d.Cli.SetLEDTimeoutContext(d.Context(), mode); err != nil {
+		log.Printf("[mqtt] %s: %v", m.Topic(), err)
+		return
+	}
+	b.publishSetting(b.topic(slug, "led"), v)
+}
+
+var ledOptions = []string{"off", "10s", "30s"}
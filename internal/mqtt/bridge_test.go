@@ -0,0 +1,125 @@
+package mqtt_test
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+	"github.com/SiirRandall/tesmart-ui/internal/events"
+	"github.com/SiirRandall/tesmart-ui/internal/mqtt"
+	"github.com/SiirRandall/tesmart-ui/internal/simulator"
+)
+
+// newSwitch starts a simulator with input active and a device named name
+// pointed at it.
+func newSwitch(t *testing.T, name string, active int, bus *events.Bus) (*simulator.Device, *device.Device) {
+	t.Helper()
+	st := simulator.DefaultState()
+	st.Active = active
+	sim := simulator.New(st)
+	sim.Logf = func(string, ...any) {}
+	if err := sim.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sim.Close() })
+
+	m, _ := config.LookupModel(config.DefaultModel)
+	cfg := config.DefaultDevice(m)
+	addr := sim.Addr().(*net.TCPAddr)
+	cfg.Name, cfg.IP, cfg.Port = name, addr.IP.String(), addr.Port
+	d := device.New(cfg, time.Second)
+	d.Events = bus
+	t.Cleanup(d.Close)
+	d.PollOnce()
+	return sim, d
+}
+
+func waitSim(t *testing.T, sim *simulator.Device, ok func(simulator.State) bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if ok(sim.State()) {
+			return
+		}
+	}
+	t.Fatalf("simulator state %+v", sim.State())
+}
+
+func TestBridge(t *testing.T) {
+	brk := newBroker(t)
+	bus := events.NewBus(64)
+	// Both names reduce to the slug rack_a.
+	simA, devA := newSwitch(t, "Rack A", 3, bus)
+	simB, devB := newSwitch(t, "rack-a", 5, bus)
+
+	cfg := &config.Config{VerifyAfterSet: true, MQTT: config.MQTT{
+		Broker: brk.url(), ClientID: "test", TopicPrefix: "tesmart", DiscoveryPrefix: "homeassistant",
+	}}
+	b := mqtt.New(cfg, []*device.Device{devA, devB}, bus)
+	b.Start()
+
+	brk.waitRetained(t, "tesmart/bridge/availability", "online")
+	brk.waitRetained(t, "tesmart/rack_a/input", devA.Config().InputName(3))
+	brk.waitRetained(t, "tesmart/rack_a_2/input", devB.Config().InputName(5))
+	brk.waitRetained(t, "tesmart/rack_a/availability", "online")
+	for _, slug := range []string{"rack_a", "rack_a_2"} {
+		brk.waitRetained(t, "tesmart/"+slug+"/buzzer", "ON")
+		brk.waitRetained(t, "tesmart/"+slug+"/led", "off")
+	}
+
+	ids := map[string]string{}
+	for _, name := range []string{"rack_a", "rack_a_2"} {
+		topic := "homeassistant/select/tesmart_" + name + "/input/config"
+		var e struct {
+			UniqueID   string `json:"unique_id"`
+			StateTopic string `json:"state_topic"`
+		}
+		if err := json.Unmarshal([]byte(brk.retainedValue(topic)), &e); err != nil {
+			t.Fatalf("%s: %v", topic, err)
+		}
+		if e.StateTopic != "tesmart/"+name+"/input" {
+			t.Errorf("%s: state_topic %q", topic, e.StateTopic)
+		}
+		if prev, dup := ids[e.UniqueID]; dup {
+			t.Errorf("%s and %s share unique_id %q", prev, name, e.UniqueID)
+		}
+		ids[e.UniqueID] = name
+	}
+
+	// Commands reach the switch behind the topic, and the new state is
+	// published.
+	brk.publish("tesmart/rack_a_2/input/set", "2", false)
+	waitSim(t, simB, func(st simulator.State) bool { return st.Active == 2 })
+	brk.waitRetained(t, "tesmart/rack_a_2/input", devB.Config().InputName(2))
+	if got := simA.State().Active; got != 3 {
+		t.Errorf("rack_a switched to %d", got)
+	}
+
+	brk.publish("tesmart/rack_a/buzzer/set", "off", false)
+	waitSim(t, simA, func(st simulator.State) bool { return !st.Buzzer })
+	brk.waitRetained(t, "tesmart/rack_a/buzzer", "OFF")
+
+	brk.publish("tesmart/rack_a/led/set", "30s", false)
+	waitSim(t, simA, func(st simulator.State) bool { return st.LEDTimeout == 0x1E })
+	brk.waitRetained(t, "tesmart/rack_a/led", "30s")
+
+	b.Close()
+	brk.waitRetained(t, "tesmart/bridge/availability", "offline")
+}
+
+func TestSlug(t *testing.T) {
+	tests := map[string]string{
+		"Rack A":      "rack_a",
+		"  desk-2  ":  "desk_2",
+		"Büro":        "b_ro",
+		"!!!":         "switch",
+		"HDMI_Switch": "hdmi_switch",
+	}
+	for in, want := range tests {
+		if got := mqtt.Slug(in); got != want {
+			t.Errorf("Slug(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
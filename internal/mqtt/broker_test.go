@@ -0,0 +1,254 @@
+package mqtt_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// broker is just enough of an MQTT 3.1.1 broker for the bridge: CONNECT,
+// SUBSCRIBE with wildcards, PUBLISH at QoS 0 and 1, retained messages and
+// keep-alive. Everything is delivered at QoS 0.
+type broker struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	retained map[string]string
+	sessions map[*session]bool
+}
+
+type session struct {
+	conn net.Conn
+	wmu  sync.Mutex
+	subs []string // guarded by broker.mu
+}
+
+const (
+	pktConnect     = 1
+	pktConnack     = 2
+	pktPublish     = 3
+	pktPuback      = 4
+	pktSubscribe   = 8
+	pktSuback      = 9
+	pktUnsubscribe = 10
+	pktUnsuback    = 11
+	pktPingreq     = 12
+	pktPingresp    = 13
+	pktDisconnect  = 14
+)
+
+func newBroker(t *testing.T) *broker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &broker{ln: ln, retained: map[string]string{}, sessions: map[*session]bool{}}
+	go b.serve()
+	t.Cleanup(b.close)
+	return b
+}
+
+func (b *broker) url() string { return "tcp://" + b.ln.Addr().String() }
+
+func (b *broker) close() {
+	_ = b.ln.Close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.sessions {
+		_ = s.conn.Close()
+	}
+}
+
+func (b *broker) serve() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		s := &session{conn: conn}
+		b.mu.Lock()
+		b.sessions[s] = true
+		b.mu.Unlock()
+		go b.handle(s)
+	}
+}
+
+func (b *broker) handle(s *session) {
+	defer func() {
+		b.mu.Lock()
+		delete(b.sessions, s)
+		b.mu.Unlock()
+		_ = s.conn.Close()
+	}()
+	r := bufio.NewReader(s.conn)
+	for {
+		typ, flags, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch typ {
+		case pktConnect:
+			s.write(pktConnack<<4, []byte{0, 0})
+		case pktPublish:
+			topic, rest := readString(body)
+			qos := flags >> 1 & 3
+			if qos > 0 {
+				s.write(pktPuback<<4, rest[:2])
+				rest = rest[2:]
+			}
+			b.publish(topic, string(rest), flags&1 == 1)
+		case pktSubscribe:
+			id, rest := body[:2], body[2:]
+			var filters []string
+			for len(rest) > 0 {
+				var f string
+				f, rest = readString(rest)
+				filters = append(filters, f)
+				rest = rest[1:] // requested QoS
+			}
+			b.mu.Lock()
+			s.subs = append(s.subs, filters...)
+			var replay [][2]string
+			for topic, payload := range b.retained {
+				for _, f := range filters {
+					if match(f, topic) {
+						replay = append(replay, [2]string{topic, payload})
+						break
+					}
+				}
+			}
+			b.mu.Unlock()
+			s.write(pktSuback<<4, append(id, make([]byte, len(filters))...))
+			for _, m := range replay {
+				s.deliver(m[0], m[1], true)
+			}
+		case pktUnsubscribe:
+			s.write(pktUnsuback<<4, body[:2])
+		case pktPingreq:
+			s.write(pktPingresp<<4, nil)
+		case pktDisconnect:
+			return
+		}
+	}
+}
+
+// publish stores a retained message and routes it to the subscribers.
+func (b *broker) publish(topic, payload string, retain bool) {
+	b.mu.Lock()
+	if retain {
+		if payload == "" {
+			delete(b.retained, topic)
+		} else {
+			b.retained[topic] = payload
+		}
+	}
+	var to []*session
+	for s := range b.sessions {
+		for _, f := range s.subs {
+			if match(f, topic) {
+				to = append(to, s)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+	for _, s := range to {
+		s.deliver(topic, payload, false)
+	}
+}
+
+// waitRetained waits for topic to hold want.
+func (b *broker) waitRetained(t *testing.T, topic, want string) {
+	t.Helper()
+	var got string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		b.mu.Lock()
+		got = b.retained[topic]
+		b.mu.Unlock()
+		if got == want {
+			return
+		}
+	}
+	t.Fatalf("%s = %q, want %q", topic, got, want)
+}
+
+func (b *broker) retainedValue(topic string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.retained[topic]
+}
+
+func (s *session) deliver(topic, payload string, retain bool) {
+	var flags byte
+	if retain {
+		flags = 1
+	}
+	body := binary.BigEndian.AppendUint16(nil, uint16(len(topic)))
+	body = append(append(body, topic...), payload...)
+	s.write(pktPublish<<4|flags, body)
+}
+
+func (s *session) write(header byte, body []byte) {
+	pkt := []byte{header}
+	for n := len(body); ; {
+		c := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			c |= 0x80
+		}
+		pkt = append(pkt, c)
+		if n == 0 {
+			break
+		}
+	}
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	_, _ = s.conn.Write(append(pkt, body...))
+}
+
+func readPacket(r *bufio.Reader) (typ, flags byte, body []byte, err error) {
+	h, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	n, mult := 0, 1
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		n += int(c&0x7F) * mult
+		if c&0x80 == 0 {
+			break
+		}
+		mult *= 128
+	}
+	body = make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return h >> 4, h & 0x0F, body, err
+}
+
+func readString(b []byte) (string, []byte) {
+	n := int(binary.BigEndian.Uint16(b))
+	return string(b[2 : 2+n]), b[2+n:]
+}
+
+// match reports whether topic matches the filter, with + and # wildcards.
+func match(filter, topic string) bool {
+	f, t := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+		if i >= len(t) || (level != "+" && level != t[i]) {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
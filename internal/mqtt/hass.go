@@ -0,0 +1,90 @@
+package mqtt
+
+import (
+	"encoding/json"
+
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+)
+
+// Home Assistant MQTT discovery; see
+// https://www.home-assistant.io/integrations/mqtt/#mqtt-discovery
+
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+type haAvailability struct {
+	Topic string `json:"topic"`
+}
+
+// haEntity covers the fields of the select and switch components we use.
+type haEntity struct {
+	Name             string           `json:"name"`
+	UniqueID         string           `json:"unique_id"`
+	Icon             string           `json:"icon,omitempty"`
+	StateTopic       string           `json:"state_topic"`
+	CommandTopic     string           `json:"command_topic"`
+	Options          []string         `json:"options,omitempty"`
+	Availability     []haAvailability `json:"availability"`
+	AvailabilityMode string           `json:"availability_mode"`
+	Device           haDevice         `json:"device"`
+}
+
+type discoveryConfig struct {
+	topic   string
+	payload string
+}
+
+// Entities per switch: component and object id.
+var haEntities = [][2]string{{"select", "input"}, {"switch", "buzzer"}, {"select", "led"}}
+
+func (b *Bridge) discoveryTopics(slug string) []string {
+	out := make([]string, len(haEntities))
+	for i, e := range haEntities {
+		out[i] = b.cfg.DiscoveryPrefix + "/" + e[0] + "/tesmart_" + slug + "/" + e[1] + "/config"
+	}
+	return out
+}
+
+func (b *Bridge) discoveryConfigs(d *device.Device, slug string) []discoveryConfig {
+	dc := d.Config()
+	dev := haDevice{
+		Identifiers:  []string{"tesmart_" + slug},
+		Name:         dc.Name,
+		Manufacturer: "TESmart",
+		Model:        dc.Profile().Title() + " HDMI Switch",
+	}
+	avail := []haAvailability{{b.topic("bridge", "availability")}, {b.topic(slug, "availability")}}
+	entity := func(name, object, icon string, options []string) haEntity {
+		return haEntity{
+			Name:             name,
+			UniqueID:         "tesmart_" + slug + "_" + object,
+			Icon:             icon,
+			StateTopic:       b.topic(slug, object),
+			CommandTopic:     b.topic(slug, object, "set"),
+			Options:          options,
+			Availability:     avail,
+			AvailabilityMode: "all",
+			Device:           dev,
+		}
+	}
+	inputs := make([]string, dc.PortCount())
+	for i := range inputs {
+		inputs[i] = dc.InputName(i + 1)
+	}
+	entities := []haEntity{
+		entity("Input", "input", "mdi:video-input-hdmi", inputs),
+		entity("Buzzer", "buzzer", "mdi:volume-high", nil),
+		entity("LED timeout", "led", "mdi:led-on", ledOptions),
+	}
+	topics := b.discoveryTopics(slug)
+	out := make([]discoveryConfig, len(entities))
+	for i, e := range entities {
+		p, _ := json.Marshal(e)
+		out[i] = discoveryConfig{topics[i], string(p)}
+	}
+	return out
+}
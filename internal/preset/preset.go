@@ -0,0 +1,96 @@
+// Package preset runs presets: named, ordered actions over one or more
+// switches, such as "switch the desk to the laptop and mute the buzzer".
+package preset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+	"github.com/SiirRandall/tesmart-ui/internal/protocol"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+)
+
+// Lookup returns the switch named name ("" = the first), or nil.
+type Lookup func(name string) *device.Device
+
+// Failed is returned by Run when steps failed. It unwraps to the first
+// failure, so errors.Is and client.Hint see through it.
+type Failed struct {
+	Failed, Total int
+	First         error
+}
+
+func (e *Failed) Error() string {
+	return fmt.Sprintf("%d of %d steps failed: %v", e.Failed, e.Total, e.First)
+}
+
+func (e *Failed) Unwrap() error { return e.First }
+
+// Run executes p's steps in order. A failed step does not stop the later
+// ones, which often address another switch. verify and source apply to
+// input steps as in device.Switch.
+func Run(ctx context.Context, p *config.Preset, lookup Lookup, verify bool, source string) (*schema.Preset, error) {
+	out := &schema.Preset{Name: p.Name, Steps: make([]schema.PresetStep, len(p.Steps))}
+	var fail *Failed
+	for i, s := range p.Steps {
+		res := &out.Steps[i]
+		res.Device = s.Device
+		err := ctx.Err()
+		if err == nil {
+			err = step(ctx, s, res, lookup, verify, source)
+		}
+		if err != nil {
+			res.Error = schema.NewError(err)
+			if fail == nil {
+				fail = &Failed{Total: len(p.Steps), First: err}
+			}
+			fail.Failed++
+			continue
+		}
+		res.OK = true
+	}
+	if fail != nil {
+		return out, fail
+	}
+	return out, nil
+}
+
+func step(ctx context.Context, s config.PresetStep, res *schema.PresetStep, lookup Lookup, verify bool, source string) error {
+	d := lookup(s.Device)
+	if d == nil {
+		return fmt.Errorf("no switch named %q", s.Device)
+	}
+	res.Device = d.Name()
+	action, value, err := s.Action()
+	res.Action, res.Value = action, value
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "input":
+		dc := d.Config()
+		port, err := dc.ResolveInput(value)
+		if err != nil {
+			return err
+		}
+		res.Value = dc.InputName(port)
+		_, err = d.SwitchContext(ctx, port, verify, source)
+		return err
+	case "buzzer":
+		value = strings.ToLower(value)
+		if value != "on" && value != "off" {
+			return fmt.Errorf("buzzer takes on or off, not %q", value)
+		}
+		return d.Cli.SetBuzzerContext(ctx, value == "on")
+	default: // led
+		m, ok := protocol.ParseLEDTimeout(strings.ToLower(value))
+		if !ok {
+			return fmt.Errorf("led takes off, 10s or 30s, not %q", value)
+		}
+		return d.Cli.SetLEDTimeoutContext(ctx, m)
+	}
+}
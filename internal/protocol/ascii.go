@@ -0,0 +1,86 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NetField is one of the ASCII network settings.
+type NetField string
+
+const (
+	FieldIP      NetField = "IP"
+	FieldPort    NetField = "PT"
+	FieldMask    NetField = "MA"
+	FieldGateway NetField = "GW"
+)
+
+// ReplyTerm ends every ASCII query reply ("IP:192.168.001.010;").
+const ReplyTerm = ';'
+
+// Query encodes a read of f, e.g. "IP?".
+func Query(f NetField) []byte { return []byte(string(f) + "?") }
+
+// Set encodes a write of f, e.g. "IP:192.168.1.20;".
+func Set(f NetField, value string) []byte { return []byte(string(f) + ":" + value + ";") }
+
+// SetPort encodes "PT:n;".
+func SetPort(port int) []byte { return Set(FieldPort, strconv.Itoa(port)) }
+
+// Clean strips the NUL padding and line endings some firmware adds.
+func Clean(b []byte) string {
+	return strings.NewReplacer("\x00", "", "\r", "", "\n", "").Replace(string(b))
+}
+
+// ParseReply extracts the value from a reply to Query(f). The field prefix
+// and terminator are optional; anything after the terminator is ignored.
+func ParseReply(f NetField, b []byte) (string, error) {
+	s := strings.TrimSpace(Clean(b))
+	if cut := strings.IndexByte(s, ReplyTerm); cut >= 0 {
+		s = s[:cut]
+	}
+	s = strings.TrimPrefix(s, string(f)+":")
+	if s == "" {
+		return "", fmt.Errorf("empty %s reply", f)
+	}
+	return s, nil
+}
+
+// DecodeAddr turns a zero-padded dotted quad ("192.168.001.010") into its
+// usual form.
+func DecodeAddr(raw string) string {
+	parts := strings.Split(keep(raw, "0123456789."), ".")
+	for i := range parts {
+		if n, err := strconv.Atoi(parts[i]); err == nil {
+			parts[i] = strconv.Itoa(n)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// DecodePort parses a PT reply value.
+func DecodePort(raw string) (int, error) {
+	p, err := strconv.Atoi(keep(raw, "0123456789"))
+	if err != nil || p <= 0 || p > 65535 {
+		return 0, fmt.Errorf("invalid port %q", raw)
+	}
+	return p, nil
+}
+
+// IsOK reports whether a reply to Set accepts the value. Silence counts as
+// acceptance: not every firmware answers.
+func IsOK(b []byte) bool {
+	s := strings.TrimSpace(Clean(b))
+	return s == "" || strings.Contains(s, "OK")
+}
+
+func keep(s, chars string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(chars, r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,89 @@
+package protocol_test
+
+import (
+	"testing"
+
+	"github.com/SiirRandall/tesmart-ui/internal/protocol"
+)
+
+func TestASCIIEncode(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{string(protocol.Query(protocol.FieldIP)), "IP?"},
+		{string(protocol.Query(protocol.FieldGateway)), "GW?"},
+		{string(protocol.Set(protocol.FieldMask, "255.255.255.0")), "MA:255.255.255.0;"},
+		{string(protocol.SetPort(5000)), "PT:5000;"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("encoded %q, want %q", tt.got, tt.want)
+		}
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		field protocol.NetField
+		in    string
+		want  string
+		err   bool
+	}{
+		{"full", protocol.FieldIP, "IP:192.168.001.010;", "192.168.001.010", false},
+		{"no prefix", protocol.FieldIP, "192.168.001.010;", "192.168.001.010", false},
+		{"no terminator", protocol.FieldPort, "PT:5000", "5000", false},
+		{"NUL padded", protocol.FieldPort, "PT:05000;\x00\x00\x00", "05000", false},
+		{"line ending", protocol.FieldGateway, "GW:192.168.001.001;\r\n", "192.168.001.001", false},
+		{"trailing junk", protocol.FieldMask, "MA:255.255.255.000;IP:", "255.255.255.000", false},
+		{"empty", protocol.FieldIP, "\x00\x00", "", true},
+		{"prefix only", protocol.FieldIP, "IP:;", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := protocol.ParseReply(tt.field, []byte(tt.in))
+			if (err != nil) != tt.err || got != tt.want {
+				t.Errorf("ParseReply = %q, %v; want %q (error %v)", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestDecodeValues(t *testing.T) {
+	addrs := map[string]string{
+		"192.168.001.010":   "192.168.1.10",
+		"010.000.000.001":   "10.0.0.1",
+		"255.255.255.000":   "255.255.255.0",
+		" 192.168.1.10\x00": "192.168.1.10",
+	}
+	for in, want := range addrs {
+		if got := protocol.DecodeAddr(in); got != want {
+			t.Errorf("DecodeAddr(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	ports := []struct {
+		in   string
+		want int
+		err  bool
+	}{
+		{"05000", 5000, false},
+		{"5000\x00", 5000, false},
+		{"0", 0, true},
+		{"70000", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range ports {
+		got, err := protocol.DecodePort(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("DecodePort(%q) = %d, %v; want %d (error %v)", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+
+	oks := map[string]bool{"": true, "OK;": true, "\x00\x00": true, "ERR;": false, "IP:1.2.3.4;": false}
+	for in, want := range oks {
+		if got := protocol.IsOK([]byte(in)); got != want {
+			t.Errorf("IsOK(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
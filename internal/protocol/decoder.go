@@ -0,0 +1,95 @@
+package protocol
+
+// MaxPending bounds how many undecoded bytes a Decoder keeps.
+const MaxPending = 4096
+
+// Decoder splits a byte stream into frames. Bytes may arrive in any chunking:
+// a frame split across reads is completed by a later Feed, several frames in
+// one read are all returned, and anything that is not a well-formed frame
+// (NUL padding, ASCII replies, line noise) is skipped.
+type Decoder struct {
+	buf []byte
+}
+
+// Feed appends p and returns the frames completed by it, in stream order.
+func (d *Decoder) Feed(p []byte) []Frame {
+	d.buf = append(d.buf, p...)
+	frames, rest := split(d.buf)
+	// Keep only the tail that may still become a frame.
+	d.buf = append(d.buf[:0], rest...)
+	if len(d.buf) > MaxPending {
+		d.buf = d.buf[len(d.buf)-MaxPending:]
+	}
+	return frames
+}
+
+// Pending returns the bytes held back as a possible partial frame.
+func (d *Decoder) Pending() []byte { return d.buf }
+
+// Reset drops any partial frame.
+func (d *Decoder) Reset() { d.buf = d.buf[:0] }
+
+// Frames returns the complete frames in buf.
+func Frames(buf []byte) []Frame {
+	frames, _ := split(buf)
+	return frames
+}
+
+// LastStatus returns the newest status frame in buf, so a stale reply queued
+// ahead of the real one does not win.
+func LastStatus(buf []byte) (Status, bool) {
+	frames := Frames(buf)
+	for i := len(frames) - 1; i >= 0; i-- {
+		if st, ok := frames[i].Status(); ok {
+			return st, true
+		}
+	}
+	return Status{}, false
+}
+
+// ScanStatus is LastStatus with a fallback for firmware that garbles the
+// trailer: failing a complete frame, it accepts the newest AA BB 03 11 xx.
+func ScanStatus(buf []byte) (Status, bool) {
+	if st, ok := LastStatus(buf); ok {
+		return st, true
+	}
+	for i := len(buf) - 5; i >= 0; i-- {
+		if buf[i] == header[0] && buf[i+1] == header[1] && buf[i+2] == header[2] && buf[i+3] == CmdStatus {
+			return Status{Active: int(buf[i+4]) + 1}, true
+		}
+	}
+	return Status{}, false
+}
+
+// split extracts complete frames from buf and returns the unconsumed tail
+// that is a prefix of a frame (empty if none).
+func split(buf []byte) ([]Frame, []byte) {
+	var frames []Frame
+	i := 0
+	for i < len(buf) {
+		if !maybeFrame(buf[i:]) {
+			i++
+			continue
+		}
+		if len(buf)-i < FrameLen {
+			return frames, buf[i:]
+		}
+		frames = append(frames, Frame{Cmd: buf[i+3], Arg: buf[i+4]})
+		i += FrameLen
+	}
+	return frames, nil
+}
+
+// maybeFrame reports whether b starts with a frame, or with a prefix of one
+// when b is shorter than a frame.
+func maybeFrame(b []byte) bool {
+	for j := 0; j < len(b) && j < FrameLen; j++ {
+		switch {
+		case j < 3 && b[j] != header[j]:
+			return false
+		case j == FrameLen-1 && b[j] != Trailer:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,168 @@
+package protocol_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/SiirRandall/tesmart-ui/internal/protocol"
+)
+
+func frame(cmd, arg byte) []byte { return protocol.Frame{Cmd: cmd, Arg: arg}.Bytes() }
+
+func cat(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+func TestDecoderChunking(t *testing.T) {
+	status3 := frame(protocol.CmdStatus, 2)
+	status5 := frame(protocol.CmdStatus, 4)
+	tests := []struct {
+		name string
+		in   []byte
+		want []protocol.Frame
+	}{
+		{"single", status3, []protocol.Frame{{protocol.CmdStatus, 2}}},
+		{"concatenated", cat(status3, status5), []protocol.Frame{{protocol.CmdStatus, 2}, {protocol.CmdStatus, 4}}},
+		{"noise between", cat([]byte{0x00, 0xAA}, status3, []byte("OK;"), status5),
+			[]protocol.Frame{{protocol.CmdStatus, 2}, {protocol.CmdStatus, 4}}},
+		{"NUL padding", cat(status3, make([]byte, 16)), []protocol.Frame{{protocol.CmdStatus, 2}}},
+		{"bad trailer", cat(status3[:5], []byte{0x00}, status5), []protocol.Frame{{protocol.CmdStatus, 4}}},
+		{"header inside junk", cat([]byte{0xAA, 0xBB, 0xAA, 0xBB, 0x03}, status3), []protocol.Frame{{protocol.CmdStatus, 2}}},
+		{"partial", status3[:4], nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := protocol.Frames(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Frames = %v, want %v", got, tt.want)
+			}
+			// However the stream is cut, the decoder finds the same frames.
+			for size := 1; size <= len(tt.in); size++ {
+				var dec protocol.Decoder
+				var got []protocol.Frame
+				for i := 0; i < len(tt.in); i += size {
+					got = append(got, dec.Feed(tt.in[i:min(i+size, len(tt.in))])...)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Fatalf("fed %d bytes at a time: %v, want %v", size, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecoderPending(t *testing.T) {
+	var dec protocol.Decoder
+	f := frame(protocol.CmdStatus, 1)
+	if got := dec.Feed(f[:3]); len(got) != 0 {
+		t.Fatalf("partial frame decoded: %v", got)
+	}
+	if !bytes.Equal(dec.Pending(), f[:3]) {
+		t.Fatalf("Pending = % X, want % X", dec.Pending(), f[:3])
+	}
+	dec.Reset()
+	if got := dec.Feed(f[3:]); len(got) != 0 {
+		t.Fatalf("frame decoded across Reset: %v", got)
+	}
+}
+
+// A device that is one answer behind sends the stale status first; the
+// newest status frame is the answer.
+func TestStatusPrefersNewest(t *testing.T) {
+	stale, fresh := frame(protocol.CmdStatus, 2), frame(protocol.CmdStatus, 6)
+	tests := []struct {
+		name string
+		in   []byte
+		want int
+		ok   bool
+	}{
+		{"stale then fresh", cat(stale, fresh), 7, true},
+		{"other frame after", cat(fresh, frame(protocol.CmdBuzzer, 1)), 7, true},
+		{"no status", frame(protocol.CmdBuzzer, 1), 0, false},
+		{"empty", nil, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, ok := protocol.LastStatus(tt.in)
+			if ok != tt.ok || st.Active != tt.want {
+				t.Errorf("LastStatus = %v, %v; want %d, %v", st, ok, tt.want, tt.ok)
+			}
+			st, ok = protocol.ScanStatus(tt.in)
+			if ok != tt.ok || st.Active != tt.want {
+				t.Errorf("ScanStatus = %v, %v; want %d, %v", st, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestScanStatusGarbledTrailer(t *testing.T) {
+	in := cat(frame(protocol.CmdStatus, 2)[:5], []byte{0x00}, frame(protocol.CmdStatus, 6)[:5], []byte{0xFF})
+	if st, ok := protocol.ScanStatus(in); !ok || st.Active != 7 {
+		t.Errorf("ScanStatus = %v, %v; want 7 (the newest)", st, ok)
+	}
+	if _, ok := protocol.LastStatus(in); ok {
+		t.Error("LastStatus accepted a frame without its trailer")
+	}
+}
+
+func TestCommandFrames(t *testing.T) {
+	tests := []struct {
+		cmd  protocol.Command
+		want string
+	}{
+		{protocol.SwitchInput{Input: 3}, "AABB030103EE"},
+		{protocol.SwitchInput{Input: 3, ZeroBased: true}, "AABB031102EE"},
+		{protocol.QueryActive{}, "AABB031000EE"},
+		{protocol.Buzzer{On: true}, "AABB030201EE"},
+		{protocol.Buzzer{}, "AABB030200EE"},
+		{protocol.LED10s, "AABB03030AEE"},
+		{protocol.Status{Active: 16}, "AABB03110FEE"},
+	}
+	for _, tt := range tests {
+		if got := tt.cmd.Frame().String(); got != tt.want {
+			t.Errorf("%#v encodes to %s, want %s", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+// FuzzDecoder checks that the decoder never panics, that every frame it
+// reports is really in the stream and round-trips through encoding, and
+// that the result does not depend on how the stream is cut.
+func FuzzDecoder(f *testing.F) {
+	f.Add(frame(protocol.CmdStatus, 2), 3)
+	f.Add(cat(frame(protocol.CmdStatus, 2), frame(protocol.CmdStatus, 4)), 5)
+	f.Add(cat([]byte{0xAA, 0xBB, 0x03, 0x11}, []byte("IP:192.168.001.010;"), make([]byte, 4)), 1)
+	f.Add([]byte{0xAA, 0xBB, 0xAA, 0xBB, 0x03, 0x11, 0x00, 0xEE}, 2)
+	f.Fuzz(func(t *testing.T, in []byte, chunk int) {
+		want := protocol.Frames(in)
+
+		rest := in
+		for _, fr := range want {
+			b := fr.Bytes()
+			if got := protocol.Frames(b); len(got) != 1 || got[0] != fr {
+				t.Fatalf("%v does not round-trip: %v", fr, got)
+			}
+			i := bytes.Index(rest, b)
+			if i < 0 {
+				t.Fatalf("%v is not in the stream % X", fr, in)
+			}
+			rest = rest[i+len(b):]
+		}
+
+		chunk = 1 + int(uint(chunk)%uint(len(in)+1))
+		var dec protocol.Decoder
+		var got []protocol.Frame
+		for i := 0; i < len(in); i += chunk {
+			got = append(got, dec.Feed(in[i:min(i+chunk, len(in))])...)
+			if len(dec.Pending()) > protocol.MaxPending {
+				t.Fatalf("decoder holds %d bytes", len(dec.Pending()))
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("chunks of %d: %v, want %v", chunk, got, want)
+		}
+
+		if st, ok := protocol.LastStatus(in); ok && st.Active < 1 {
+			t.Fatalf("status with input %d", st.Active)
+		}
+		_, _ = protocol.ScanStatus(in)
+	})
+}
@@ -0,0 +1,109 @@
+// Package protocol encodes and decodes the TESmart control protocol: 6-byte
+// binary frames (AA BB 03 cmd arg EE) for switching and status, and the ASCII
+// IP/PT/MA/GW command family for network settings.
+package protocol
+
+import "fmt"
+
+// Frame layout.
+const (
+	FrameLen = 6
+	Trailer  = 0xEE
+)
+
+var header = [3]byte{0xAA, 0xBB, 0x03}
+
+// Command bytes.
+const (
+	CmdSwitch     byte = 0x01 // select input, 1-based argument
+	CmdBuzzer     byte = 0x02 // 0x00 mute, 0x01 unmute
+	CmdLEDTimeout byte = 0x03 // 0x00 off, 0x0A 10s, 0x1E 30s
+	CmdQuery      byte = 0x10 // ask for the active input
+	CmdStatus     byte = 0x11 // active-input reply; as a command, 0-based switch
+)
+
+// Frame is one binary frame without its fixed header and trailer.
+type Frame struct {
+	Cmd byte
+	Arg byte
+}
+
+// Bytes encodes f as AA BB 03 cmd arg EE.
+func (f Frame) Bytes() []byte {
+	return []byte{header[0], header[1], header[2], f.Cmd, f.Arg, Trailer}
+}
+
+func (f Frame) String() string { return fmt.Sprintf("AABB03%02X%02XEE", f.Cmd, f.Arg) }
+
+// Status interprets f as an active-input reply.
+func (f Frame) Status() (Status, bool) {
+	if f.Cmd != CmdStatus {
+		return Status{}, false
+	}
+	return Status{Active: int(f.Arg) + 1}, true
+}
+
+/* Commands */
+
+// Command is anything that encodes to a single frame.
+type Command interface {
+	Frame() Frame
+}
+
+// SwitchInput selects Input (1-based). ZeroBased uses the 0x11 form that
+// some firmware expects instead of 0x01.
+type SwitchInput struct {
+	Input     int
+	ZeroBased bool
+}
+
+func (c SwitchInput) Frame() Frame {
+	if c.ZeroBased {
+		return Frame{CmdStatus, byte(c.Input - 1)}
+	}
+	return Frame{CmdSwitch, byte(c.Input)}
+}
+
+// QueryActive asks for the active input; the switch answers with a Status.
+type QueryActive struct{}
+
+func (QueryActive) Frame() Frame { return Frame{CmdQuery, 0x00} }
+
+// Buzzer enables or mutes the key-press buzzer.
+type Buzzer struct{ On bool }
+
+func (c Buzzer) Frame() Frame {
+	if c.On {
+		return Frame{CmdBuzzer, 0x01}
+	}
+	return Frame{CmdBuzzer, 0x00}
+}
+
+// LEDTimeout sets how long the panel LEDs stay lit.
+type LEDTimeout byte
+
+const (
+	LEDAlwaysOn LEDTimeout = 0x00
+	LED10s      LEDTimeout = 0x0A
+	LED30s      LEDTimeout = 0x1E
+)
+
+func (c LEDTimeout) Frame() Frame { return Frame{CmdLEDTimeout, byte(c)} }
+
+// ParseLEDTimeout accepts the user-facing names "off", "10s" and "30s".
+func ParseLEDTimeout(s string) (LEDTimeout, bool) {
+	t, ok := map[string]LEDTimeout{"off": LEDAlwaysOn, "10s": LED10s, "30s": LED30s}[s]
+	return t, ok
+}
+
+// Encode is shorthand for c.Frame().Bytes().
+func Encode(c Command) []byte { return c.Frame().Bytes() }
+
+/* Responses */
+
+// Status is the switch's answer to QueryActive and to switch commands.
+type Status struct {
+	Active int // 1-based
+}
+
+func (s Status) Frame() Frame { return Frame{CmdStatus, byte(s.Active - 1)} }
@@ -0,0 +1,169 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spec is a parsed cron expression: minute, hour, day of month, month and
+// day of week, in local time. Fields take *, numbers, ranges (1-5), steps
+// (*/15, 8-18/2), lists (1,15) and, for months and weekdays, three-letter
+// names. As in cron, a day matches if either day field does when both are
+// restricted. @hourly, @daily (@midnight), @weekly, @monthly and @yearly
+// (@annually) are accepted too.
+type Spec struct {
+	minute, hour, dom, month, dow uint64 // bit n set = value n matches
+	domStar, dowStar              bool
+}
+
+var macros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+var (
+	monthNames = []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	dayNames   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// Parse reads a five-field cron expression or one of the @ macros.
+func Parse(expr string) (*Spec, error) {
+	expr = strings.TrimSpace(expr)
+	if m, ok := macros[strings.ToLower(expr)]; ok {
+		expr = m
+	}
+	f := strings.Fields(expr)
+	if len(f) != 5 {
+		return nil, fmt.Errorf("cron %q: want 5 fields (minute hour day month weekday), got %d", expr, len(f))
+	}
+	var s Spec
+	var err error
+	if s.minute, err = parseField(f[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("cron %q: minute: %w", expr, err)
+	}
+	if s.hour, err = parseField(f[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("cron %q: hour: %w", expr, err)
+	}
+	if s.dom, err = parseField(f[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("cron %q: day of month: %w", expr, err)
+	}
+	if s.month, err = parseField(f[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("cron %q: month: %w", expr, err)
+	}
+	if s.dow, err = parseField(f[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("cron %q: weekday: %w", expr, err)
+	}
+	if s.dow&(1<<7) != 0 { // 7 is Sunday too
+		s.dow |= 1
+	}
+	s.domStar, s.dowStar = strings.HasPrefix(f[2], "*"), strings.HasPrefix(f[4], "*")
+	return &s, nil
+}
+
+func parseField(field string, min, max int, names []string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+			step = n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseValue(a, min, max, names); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = parseValue(b, min, max, names); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = max // "5/10" = from 5 to the end, every 10
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(s string, min, max int, names []string) (int, error) {
+	for i, n := range names {
+		if n != "" && strings.EqualFold(s, n) {
+			return i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("%q is not in %d-%d", s, min, max)
+	}
+	return v, nil
+}
+
+// Next returns the first matching minute after t, or the zero time if there
+// is none within five years (e.g. "0 0 30 2 *"). Across daylight saving
+// changes it goes by the wall clock: a time skipped when clocks go forward
+// does not match that day, and a time repeated when they go back matches
+// only the first time.
+func (s *Spec) Next(t time.Time) time.Time {
+	from := wall(t)
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = forward(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()))
+		case !s.dayMatches(t):
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()))
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location()))
+		case s.minute&(1<<uint(t.Minute())) == 0, !wall(t).After(from):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// forward returns next, a wall time after t. If the clocks skip it,
+// time.Date may resolve it to an earlier instant; then the hour after is
+// used, so Next always moves on.
+func forward(t, next time.Time) time.Time {
+	for !next.After(t) {
+		next = next.Add(time.Hour)
+	}
+	return next
+}
+
+// wall is t's wall clock reading to the minute, comparable across offsets.
+func wall(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+func (s *Spec) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,88 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/SiirRandall/tesmart-ui/internal/schedule"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@never",
+	} {
+		if _, err := schedule.Parse(expr); err == nil {
+			t.Errorf("Parse(%q) accepted", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	santiago, err := time.LoadLocation("America/Santiago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(loc *time.Location, y int, mo time.Month, d, h, mi int) time.Time {
+		return time.Date(y, mo, d, h, mi, 0, 0, loc)
+	}
+	utc := func(y int, mo time.Month, d, h, mi int) time.Time { return at(time.UTC, y, mo, d, h, mi) }
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time // zero = never
+	}{
+		{"every minute", "* * * * *", utc(2025, 1, 1, 10, 0).Add(30 * time.Second), utc(2025, 1, 1, 10, 1)},
+		{"strictly after", "0 9 * * *", utc(2025, 1, 1, 9, 0), utc(2025, 1, 2, 9, 0)},
+		{"step", "*/15 * * * *", utc(2025, 1, 1, 10, 16), utc(2025, 1, 1, 10, 30)},
+		{"range step", "0 8-18/4 * * *", utc(2025, 1, 1, 12, 1), utc(2025, 1, 1, 16, 0)},
+		{"start step", "5/20 * * * *", utc(2025, 1, 1, 10, 26), utc(2025, 1, 1, 10, 45)},
+		{"list", "0 7,19 * * *", utc(2025, 1, 1, 8, 0), utc(2025, 1, 1, 19, 0)},
+		{"weekday names", "0 9 * * mon-fri", utc(2025, 1, 3, 10, 0), utc(2025, 1, 6, 9, 0)}, // Fri → Mon
+		{"sunday as 7", "0 9 * * 7", utc(2025, 1, 1, 0, 0), utc(2025, 1, 5, 9, 0)},
+		{"month name", "0 0 1 jul *", utc(2025, 1, 1, 0, 0), utc(2025, 7, 1, 0, 0)},
+		{"either day field", "0 0 13 * fri", utc(2025, 6, 1, 0, 0), utc(2025, 6, 6, 0, 0)},
+		{"year end", "@yearly", utc(2025, 12, 31, 23, 59), utc(2026, 1, 1, 0, 0)},
+		{"31st skips short months", "0 0 31 * *", utc(2025, 4, 1, 0, 0), utc(2025, 5, 31, 0, 0)},
+		{"leap day", "0 0 29 2 *", utc(2025, 1, 1, 0, 0), utc(2028, 2, 29, 0, 0)},
+		{"impossible", "0 0 30 2 *", utc(2025, 1, 1, 0, 0), time.Time{}},
+		{"monthly", "@monthly", utc(2025, 2, 28, 12, 0), utc(2025, 3, 1, 0, 0)},
+
+		// Clocks go forward at 02:00 on 9 March 2025: 02:30 does not exist.
+		{"in the spring gap", "30 2 * * *", at(ny, 2025, 3, 9, 0, 0), at(ny, 2025, 3, 10, 2, 30)},
+		{"across the spring gap", "0 * * * *", at(ny, 2025, 3, 9, 1, 30), at(ny, 2025, 3, 9, 3, 0)},
+		// Clocks go back at 02:00 on 2 November 2025: 01:30 happens twice.
+		{"first of a repeated time", "30 1 * * *", at(ny, 2025, 11, 2, 0, 0), at(ny, 2025, 11, 2, 1, 30)},
+		{"repeated time runs once", "30 1 * * *", at(ny, 2025, 11, 2, 1, 30), at(ny, 2025, 11, 3, 1, 30)},
+		{"hourly through the fall", "0 * * * *", at(ny, 2025, 11, 2, 1, 0), at(ny, 2025, 11, 2, 2, 0)},
+		// Clocks go forward at midnight on 7 September 2025: the day starts at 01:00.
+		{"day without midnight", "0 9 * * sun", at(santiago, 2025, 9, 6, 12, 0), at(santiago, 2025, 9, 7, 9, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := schedule.Parse(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.from, got, tt.want)
+			}
+		})
+	}
+}
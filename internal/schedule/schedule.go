@@ -0,0 +1,227 @@
+// Package schedule switches inputs at times given by cron rules in the
+// config.
+//
+// The scheduler wakes at least once a minute and compares the wall clock
+// with its last check, so it notices runs that passed while the computer
+// was suspended (when timers stop) or the clock jumped. Such runs are
+// skipped or caught up according to config.ScheduleMissed.
+package schedule
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+)
+
+// Grace is how late a run may start and still count as on time.
+const Grace = time.Minute
+
+// Clock is the scheduler's view of time; tests can supply a fake one.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Lookup returns the switch named name ("" = the first), or nil.
+type Lookup func(name string) *device.Device
+
+// Upcoming is a rule and its next run, for display.
+type Upcoming struct {
+	Rule config.Schedule
+	Next time.Time // zero if the rule never matches or is invalid
+	Err  error     // the rule's cron expression is invalid
+}
+
+type rule struct {
+	cfg  config.Schedule
+	spec *Spec
+	err  error
+}
+
+// Scheduler runs cfg.Schedules. It switches through device.Switch, so the
+// poller ignores the old input for the usual suppress window, as for a
+// switch from the window.
+type Scheduler struct {
+	// Clock defaults to the system clock. Set it before Start.
+	Clock Clock
+
+	cfg    *config.Config
+	lookup Lookup
+	wake   chan struct{}
+	done   chan struct{}
+
+	mu    sync.Mutex
+	rules []rule
+}
+
+func New(cfg *config.Config, lookup Lookup) *Scheduler {
+	s := &Scheduler{
+		Clock:  realClock{},
+		cfg:    cfg,
+		lookup: lookup,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	s.parse()
+	return s
+}
+
+func (s *Scheduler) Start() { go s.loop() }
+
+func (s *Scheduler) Close() { close(s.done) }
+
+// Reload re-reads cfg.Schedules after the config changed.
+func (s *Scheduler) Reload() {
+	s.parse()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) parse() {
+	rules := make([]rule, len(s.cfg.Schedules))
+	for i, c := range s.cfg.Schedules {
+		rules[i].cfg = c
+		rules[i].spec, rules[i].err = Parse(c.Cron)
+		if rules[i].err != nil {
+			log.Printf("[schedule] %s: %v", label(c), rules[i].err)
+		}
+	}
+	s.mu.Lock()
+	s.rules = rules
+	s.mu.Unlock()
+}
+
+func (s *Scheduler) snapshot() []rule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rules
+}
+
+// Upcoming lists every rule with its next run, soonest first; rules that
+// will not run come last.
+func (s *Scheduler) Upcoming() []Upcoming {
+	now := s.now()
+	rules := s.snapshot()
+	out := make([]Upcoming, len(rules))
+	for i, r := range rules {
+		out[i] = Upcoming{Rule: r.cfg, Err: r.err}
+		if r.spec != nil {
+			out[i].Next = r.spec.Next(now)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i].Next, out[j].Next
+		if a.IsZero() || b.IsZero() {
+			return !a.IsZero()
+		}
+		return a.Before(b)
+	})
+	return out
+}
+
+// now reads the wall clock. Times from time.Now carry a monotonic reading,
+// which comparisons prefer and which never goes back, so it is stripped:
+// the scheduler must see the clock being set back.
+func (s *Scheduler) now() time.Time { return s.Clock.Now().Round(0) }
+
+func (s *Scheduler) loop() {
+	last := s.now()
+	for {
+		wait := time.Minute
+		for _, r := range s.snapshot() {
+			if r.spec == nil {
+				continue
+			}
+			if next := r.spec.Next(last); !next.IsZero() && next.Sub(last) < wait {
+				wait = next.Sub(last)
+			}
+		}
+		select {
+		case <-s.Clock.After(wait):
+		case <-s.wake:
+			last = s.now() // new rules start from now
+			continue
+		case <-s.done:
+			return
+		}
+		now := s.now()
+		s.check(last, now)
+		if now.After(last) {
+			last = now
+		}
+	}
+}
+
+// check runs the rules due in (from, to].
+func (s *Scheduler) check(from, to time.Time) {
+	if !to.After(from) {
+		return // the clock went back; wait for it to pass from again
+	}
+	for _, r := range s.snapshot() {
+		if r.spec == nil {
+			continue
+		}
+		var onTime, missed time.Time
+		skipped := 0
+		for t := r.spec.Next(from); !t.IsZero() && !t.After(to); t = r.spec.Next(t) {
+			if to.Sub(t) <= Grace {
+				onTime = t
+			} else {
+				missed = t
+				skipped++
+			}
+		}
+		switch {
+		case !onTime.IsZero():
+			go s.run(r.cfg, "")
+		case skipped > 0 && s.cfg.ScheduleMissed == config.MissedRunLatest:
+			go s.run(r.cfg, "catching up with "+missed.Format("Mon 15:04"))
+		case skipped > 0:
+			log.Printf("[schedule] %s: skipped %d run(s) missed while asleep, last at %s",
+				label(r.cfg), skipped, missed.Format("Mon 15:04"))
+		}
+	}
+}
+
+func (s *Scheduler) run(c config.Schedule, note string) {
+	d := s.lookup(c.Device)
+	if d == nil {
+		log.Printf("[schedule] %s: no switch named %q", label(c), c.Device)
+		return
+	}
+	dc := d.Config()
+	port, err := dc.ResolveInput(c.Input)
+	if err != nil {
+		log.Printf("[schedule] %s: %v", label(c), err)
+		return
+	}
+	if note != "" {
+		log.Printf("[schedule] %s: %s", label(c), note)
+	}
+	verify := s.cfg.VerifySwitch()
+	if _, err := d.Switch(port, verify, schema.SourceSchedule); err != nil {
+		log.Printf("[schedule] %s: switch %s to %s: %v", label(c), d.Name(), dc.InputName(port), err)
+		return
+	}
+	log.Printf("[schedule] %s: switched %s to %s", label(c), d.Name(), dc.InputName(port))
+}
+
+// label names a rule in logs.
+func label(c config.Schedule) string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Cron
+}
@@ -0,0 +1,188 @@
+package schedule_test
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+	"github.com/SiirRandall/tesmart-ui/internal/schedule"
+	"github.com/SiirRandall/tesmart-ui/internal/simulator"
+)
+
+// fakeClock only moves when told to. Setting it fires the pending timers,
+// as if they ran out then: timers measure elapsed time, not the wall clock,
+// so a suspend or a clock change shows up only once the scheduler wakes.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []chan time.Time
+	waiting chan struct{} // a timer was started
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, waiting: make(chan struct{}, 16)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, ch)
+	c.waiting <- struct{}{}
+	return ch
+}
+
+// set moves the clock to t, forwards or back, and wakes the scheduler.
+func (c *fakeClock) set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+	for _, ch := range c.timers {
+		ch <- t
+	}
+	c.timers = nil
+}
+
+// settle waits until the scheduler is waiting on the clock again.
+func (c *fakeClock) settle(t *testing.T) {
+	t.Helper()
+	select {
+	case <-c.waiting:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduler did not wait on the clock")
+	}
+}
+
+// monoClock is a fakeClock whose times carry a monotonic reading, as those
+// of time.Now do.
+type monoClock struct{ *fakeClock }
+
+func (c monoClock) Now() time.Time {
+	now := time.Now()
+	return now.Add(c.fakeClock.Now().Sub(now))
+}
+
+func newDevice(t *testing.T) *device.Device {
+	t.Helper()
+	sim := simulator.New(simulator.DefaultState())
+	sim.Logf = func(string, ...any) {}
+	if err := sim.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sim.Close() })
+	m, _ := config.LookupModel(config.DefaultModel)
+	cfg := config.DefaultDevice(m)
+	addr := sim.Addr().(*net.TCPAddr)
+	cfg.Name, cfg.IP, cfg.Port = "Rack", addr.IP.String(), addr.Port
+	d := device.New(cfg, time.Second)
+	t.Cleanup(d.Close)
+	return d
+}
+
+// runs counts the switches made, once those expected are done and a little
+// more time has passed for any that should not have happened.
+func runs(d *device.Device, want uint64) uint64 {
+	count := func() (n uint64) {
+		for _, c := range d.SwitchCounts() {
+			n += c
+		}
+		return n
+	}
+	for deadline := time.Now().Add(2 * time.Second); count() < want && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(200 * time.Millisecond)
+	return count()
+}
+
+func TestScheduler(t *testing.T) {
+	day := func(h, m, s int) time.Time { return time.Date(2025, 6, 2, h, m, s, 0, time.Local) }
+	tests := []struct {
+		name   string
+		missed string
+		start  time.Time
+		steps  []time.Time // clock settings, in order
+		want   uint64      // switches made
+	}{
+		{"on time", config.MissedSkip, day(8, 59, 30), []time.Time{day(9, 0, 10)}, 1},
+		{"late within grace", config.MissedSkip, day(8, 59, 30), []time.Time{day(9, 0, 50)}, 1},
+		{"not yet", config.MissedSkip, day(8, 0, 0), []time.Time{day(8, 30, 0)}, 0},
+		{"missed, skip", config.MissedSkip, day(6, 0, 0), []time.Time{day(12, 0, 0)}, 0},
+		{"missed, run latest", config.MissedRunLatest, day(6, 0, 0), []time.Time{day(12, 0, 0)}, 1},
+		{"several missed, run latest once", config.MissedRunLatest, day(6, 0, 0),
+			[]time.Time{day(6, 0, 0).AddDate(0, 0, 3)}, 1},
+		{"clock back does not repeat a run", config.MissedSkip, day(8, 59, 50),
+			[]time.Time{day(9, 0, 5), day(8, 59, 0), day(9, 0, 30)}, 1},
+		{"clock back, then on to the next run", config.MissedSkip, day(8, 59, 50),
+			[]time.Time{day(9, 0, 5), day(8, 59, 0), day(9, 0, 30), day(8, 59, 50).AddDate(0, 0, 1), day(9, 0, 10).AddDate(0, 0, 1)}, 2},
+	}
+	for _, tt := range tests {
+		for _, mono := range []bool{false, true} {
+			name := tt.name
+			if mono {
+				name += ", monotonic"
+			}
+			t.Run(name, func(t *testing.T) {
+				d := newDevice(t)
+				cfg := &config.Config{
+					ScheduleMissed: tt.missed,
+					Schedules:      []config.Schedule{{Name: "morning", Cron: "0 9 * * *", Input: "5"}},
+				}
+				clock := newFakeClock(tt.start)
+				s := schedule.New(cfg, func(string) *device.Device { return d })
+				s.Clock = clock
+				if mono {
+					s.Clock = monoClock{clock}
+				}
+				s.Start()
+				defer s.Close()
+
+				clock.settle(t)
+				for _, step := range tt.steps {
+					clock.set(step)
+					clock.settle(t)
+				}
+				if got := runs(d, tt.want); got != tt.want {
+					t.Errorf("%d switches, want %d", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestUpcoming(t *testing.T) {
+	cfg := &config.Config{Schedules: []config.Schedule{
+		{Name: "evening", Cron: "0 18 * * *", Input: "2"},
+		{Name: "broken", Cron: "0 25 * * *", Input: "1"},
+		{Name: "never", Cron: "0 0 30 2 *", Input: "1"},
+		{Name: "morning", Cron: "0 9 * * *", Input: "1"},
+	}}
+	s := schedule.New(cfg, func(string) *device.Device { return nil })
+	s.Clock = newFakeClock(time.Date(2025, 6, 2, 12, 0, 0, 0, time.Local))
+	up := s.Upcoming()
+	var names []string
+	for _, u := range up {
+		names = append(names, u.Rule.Name)
+	}
+	if want := []string{"evening", "morning", "broken", "never"}; len(names) != 4 ||
+		names[0] != want[0] || names[1] != want[1] {
+		t.Fatalf("order %v, want %v (the last two in either order)", names, want)
+	}
+	if up[0].Next != time.Date(2025, 6, 2, 18, 0, 0, 0, time.Local) {
+		t.Errorf("evening next at %v", up[0].Next)
+	}
+	for _, u := range up[2:] {
+		if !u.Next.IsZero() || (u.Rule.Name == "broken") != (u.Err != nil) {
+			t.Errorf("%s: next %v, error %v", u.Rule.Name, u.Next, u.Err)
+		}
+	}
+}
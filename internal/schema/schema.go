@@ -0,0 +1,231 @@
+// Package schema defines the structured (JSON/YAML) form of query results.
+//
+// Field names and meanings are stable within a Version. Fields may be added
+// without bumping it; renames, removals and changes of meaning bump it.
+package schema
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/client"
+)
+
+// Version of the output schema.
+const Version = 1
+
+// Result is the envelope of every structured reply. Exactly one of the
+// payload fields is set on success; Error is set on failure.
+type Result struct {
+	Version int    `json:"version" yaml:"version"`
+	Command string `json:"command" yaml:"command"`
+	Device  string `json:"device,omitempty" yaml:"device,omitempty"`
+	Target  string `json:"target,omitempty" yaml:"target,omitempty"`
+
+	Status    *Status    `json:"status,omitempty" yaml:"status,omitempty"`
+	Switch    *Switch    `json:"switch,omitempty" yaml:"switch,omitempty"`
+	Ping      *Ping      `json:"ping,omitempty" yaml:"ping,omitempty"`
+	Setting   *Setting   `json:"setting,omitempty" yaml:"setting,omitempty"`
+	NetConfig *NetConfig `json:"netconfig,omitempty" yaml:"netconfig,omitempty"`
+	Raw       *Raw       `json:"raw,omitempty" yaml:"raw,omitempty"`
+	State     *State     `json:"state,omitempty" yaml:"state,omitempty"`
+	Ports     []Port     `json:"ports,omitempty" yaml:"ports,omitempty"`
+	Devices   []Device   `json:"devices,omitempty" yaml:"devices,omitempty"`
+	Preset    *Preset    `json:"preset,omitempty" yaml:"preset,omitempty"`
+
+	Error *Error `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// New starts a result for command.
+func New(command string) *Result { return &Result{Version: Version, Command: command} }
+
+// Input is one input of a switch with its configured name.
+type Input struct {
+	Port int    `json:"port" yaml:"port"`
+	Name string `json:"name" yaml:"name"`
+}
+
+type Status struct {
+	Active Input `json:"active" yaml:"active"`
+}
+
+// Switch results: "switched" (not read back), "verified" or "unverified".
+const (
+	SwitchSent       = "switched"
+	SwitchVerified   = "verified"
+	SwitchUnverified = "unverified"
+)
+
+type Switch struct {
+	Active Input  `json:"active" yaml:"active"`
+	Result string `json:"result" yaml:"result"`
+}
+
+type Ping struct {
+	LatencyMs float64 `json:"latency_ms" yaml:"latency_ms"`
+}
+
+// NewPing rounds d to microseconds.
+func NewPing(d time.Duration) *Ping {
+	return &Ping{LatencyMs: float64(d.Microseconds()) / 1000}
+}
+
+// Setting reports a write-only setting such as the buzzer or LED timeout.
+type Setting struct {
+	Name  string `json:"name" yaml:"name"`
+	Value string `json:"value" yaml:"value"`
+}
+
+type NetConfig struct {
+	IP      string `json:"ip" yaml:"ip"`
+	Port    int    `json:"port" yaml:"port"`
+	Mask    string `json:"mask" yaml:"mask"`
+	Gateway string `json:"gateway" yaml:"gateway"`
+	Applied bool   `json:"applied" yaml:"applied"` // true if this run changed them
+}
+
+func NewNetConfig(c client.KVMNetConfig, applied bool) *NetConfig {
+	return &NetConfig{IP: c.IP, Port: c.Port, Mask: c.Mask, Gateway: c.GW, Applied: applied}
+}
+
+// Raw carries hex strings in upper case without spaces.
+type Raw struct {
+	Sent  string `json:"sent" yaml:"sent"`
+	Reply string `json:"reply" yaml:"reply"`
+}
+
+// State is what the poller last saw. Active is nil until the first
+// successful poll.
+type State struct {
+	Active  *Input    `json:"active" yaml:"active"`
+	Online  bool      `json:"online" yaml:"online"`
+	Link    string    `json:"link" yaml:"link"` // unknown, online, degraded or offline
+	Updated time.Time `json:"updated" yaml:"updated"`
+	Error   *Error    `json:"error,omitempty" yaml:"error,omitempty"` // last poll failure while offline
+}
+
+// Port is an input's configured name and icon.
+type Port struct {
+	Port int    `json:"port" yaml:"port"`
+	Name string `json:"name" yaml:"name"`
+	Icon string `json:"icon" yaml:"icon"`
+}
+
+// Device is a configured switch.
+type Device struct {
+	Name   string `json:"name" yaml:"name"`
+	Target string `json:"target" yaml:"target"`
+	Model  string `json:"model" yaml:"model"`
+	Ports  int    `json:"ports" yaml:"ports"`
+}
+
+// Preset reports each step of a preset run; Error on the Result summarizes
+// failures.
+type Preset struct {
+	Name  string       `json:"name" yaml:"name"`
+	Steps []PresetStep `json:"steps" yaml:"steps"`
+}
+
+type PresetStep struct {
+	Device string `json:"device" yaml:"device"`
+	Action string `json:"action" yaml:"action"` // input, buzzer or led
+	Value  string `json:"value" yaml:"value"`
+	OK     bool   `json:"ok" yaml:"ok"`
+	Error  *Error `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Event types.
+const (
+	EventInputChanged   = "input_changed"
+	EventInputRequested = "input_requested" // sent without read-back; input_changed follows once confirmed
+	EventPollFailed     = "poll_failed"
+	EventPollRecovered  = "poll_recovered"
+	EventConfigChanged  = "config_changed"
+	EventLinkChanged    = "link_changed"
+)
+
+// Event sources for input_changed and input_requested.
+const (
+	SourcePoll     = "poll" // the switch reported a change (front panel, hotkey, another client)
+	SourcePush     = "push" // the switch announced a change without being asked
+	SourceUI       = "ui"
+	SourceTray     = "tray"
+	SourceAPI      = "api"
+	SourceCLI      = "cli"
+	SourceMQTT     = "mqtt"
+	SourceDBus     = "dbus"
+	SourceSchedule = "schedule"
+)
+
+// Event is one entry of the event stream. Seq increases by one per event
+// within a process; a client that reconnects passes the last Seq it saw to
+// resume.
+type Event struct {
+	Version int       `json:"version" yaml:"version"`
+	Seq     uint64    `json:"seq" yaml:"seq"`
+	Time    time.Time `json:"time" yaml:"time"`
+	Type    string    `json:"type" yaml:"type"`
+	Device  string    `json:"device" yaml:"device"`
+
+	Source   string `json:"source,omitempty" yaml:"source,omitempty"`     // input_changed
+	Input    *Input `json:"input,omitempty" yaml:"input,omitempty"`       // input_changed
+	Previous *Input `json:"previous,omitempty" yaml:"previous,omitempty"` // input_changed; nil if not known before
+	Error    *Error `json:"error,omitempty" yaml:"error,omitempty"`       // poll_failed
+	What     string `json:"what,omitempty" yaml:"what,omitempty"`         // config_changed: ports, connection, added, removed, reloaded
+	Link     string `json:"link,omitempty" yaml:"link,omitempty"`         // link_changed: online, degraded or offline
+}
+
+// Error kinds.
+const (
+	KindUnreachable     = "unreachable"
+	KindTimeout         = "timeout"
+	KindNoReply         = "no_reply"
+	KindMalformedFrame  = "malformed_frame"
+	KindUnexpectedReply = "unexpected_reply"
+	KindInputRange      = "input_range"
+	KindCancelled       = "cancelled"
+	KindUsage           = "usage"
+	KindNotFound        = "not_found"
+	KindOther           = "other"
+)
+
+type Error struct {
+	Kind    string `json:"kind" yaml:"kind"`
+	Message string `json:"message" yaml:"message"`
+	Hint    string `json:"hint,omitempty" yaml:"hint,omitempty"`
+	Raw     string `json:"raw,omitempty" yaml:"raw,omitempty"` // bytes received, hex
+}
+
+// NewError classifies err from the client.
+func NewError(err error) *Error {
+	e := &Error{Kind: KindOther, Message: err.Error(), Hint: client.Hint(err)}
+	switch {
+	case errors.Is(err, context.Canceled):
+		e.Kind = KindCancelled
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, client.ErrTimeout):
+		e.Kind = KindTimeout
+	case errors.Is(err, client.ErrUnreachable):
+		e.Kind = KindUnreachable
+	case errors.Is(err, client.ErrNoReply):
+		e.Kind = KindNoReply
+	case errors.Is(err, client.ErrMalformedFrame):
+		e.Kind = KindMalformedFrame
+	case errors.Is(err, client.ErrUnexpectedReply):
+		e.Kind = KindUnexpectedReply
+	case errors.Is(err, client.ErrInputRange):
+		e.Kind = KindInputRange
+	case errors.Is(err, client.ErrConfig):
+		e.Kind = KindUsage
+	}
+	var ce *client.Error
+	if errors.As(err, &ce) && len(ce.Raw) > 0 {
+		e.Raw = strings.ToUpper(hex.EncodeToString(ce.Raw))
+	}
+	if e.Hint == e.Message {
+		e.Hint = ""
+	}
+	return e
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+)
+
+// handleEvents streams events as Server-Sent Events. Each event carries its
+// sequence number as the SSE id, so browsers resume automatically through
+// Last-Event-ID; other clients can pass ?since=SEQ. ?device=NAME filters.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || s.events == nil {
+		http.Error(w, "event stream unavailable", http.StatusNotImplemented)
+		return
+	}
+	after := r.Header.Get("Last-Event-ID")
+	if v := r.URL.Query().Get("since"); v != "" {
+		after = v
+	}
+	since, _ := strconv.ParseUint(after, 10, 64)
+	device := r.URL.Query().Get("device")
+
+	backlog, ch, cancel := s.events.Subscribe(since)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	send := func(e schema.Event) bool {
+		if device != "" && e.Device != device {
+			return true
+		}
+		b, _ := json.Marshal(e)
+		_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Seq, e.Type, b)
+		return err == nil
+	}
+	for _, e := range backlog {
+		if !send(e) {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return // fell behind; the client reconnects and resumes
+			}
+			if !send(e) {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
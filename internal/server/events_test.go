@@ -0,0 +1,120 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/events"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+	"github.com/SiirRandall/tesmart-ui/internal/server"
+)
+
+// stream opens GET url with the given Last-Event-ID (none if empty) until ctx
+// ends, and returns a function reading the id of each event that follows.
+func stream(t *testing.T, ctx context.Context, url, lastID string) (next func() string) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type %q", ct)
+	}
+	ids := make(chan string)
+	go func() {
+		defer close(ids)
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			if id, ok := strings.CutPrefix(sc.Text(), "id: "); ok {
+				ids <- id
+			}
+		}
+	}()
+	return func() string {
+		t.Helper()
+		select {
+		case id := <-ids:
+			return id
+		case <-time.After(2 * time.Second):
+			t.Fatal("no event")
+			return ""
+		}
+	}
+}
+
+func serve(t *testing.T) (url string, publish func(device string)) {
+	t.Helper()
+	bus := events.NewBus(16)
+	srv := httptest.NewServer(server.New(&config.Config{}, nil, bus).Handler())
+	t.Cleanup(srv.Close)
+	return srv.URL, func(device string) {
+		bus.Publish(schema.Event{Type: schema.EventInputChanged, Device: device})
+	}
+}
+
+func TestEventsResume(t *testing.T) {
+	for _, tc := range []struct {
+		name, path, lastID string
+		want               []string
+	}{
+		{"Last-Event-ID", "/events", "1", []string{"2", "3", "4"}},
+		{"since", "/events?since=2", "", []string{"3", "4"}},
+		{"since over Last-Event-ID", "/events?since=2", "1", []string{"3", "4"}},
+		{"device", "/events?device=Rack", "", []string{"1", "3", "4"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			url, publish := serve(t)
+			publish("Rack")
+			publish("Lab")
+			publish("Rack")
+			next := stream(t, context.Background(), url+tc.path, tc.lastID)
+			for i, want := range tc.want {
+				if i == len(tc.want)-1 {
+					publish("Rack") // live, after the backlog
+				}
+				if got := next(); got != want {
+					t.Fatalf("event %d: id %s, want %s", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+// A client that drops and reconnects with the last id it saw misses nothing.
+func TestEventsReconnect(t *testing.T) {
+	url, publish := serve(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	next := stream(t, ctx, url+"/events", "")
+	publish("Rack")
+	publish("Rack")
+	if got := next(); got != "1" {
+		t.Fatalf("id %s, want 1", got)
+	}
+	last := next()
+	if last != "2" {
+		t.Fatalf("id %s, want 2", last)
+	}
+	cancel()
+
+	publish("Rack") // while disconnected
+	next = stream(t, context.Background(), url+"/events", last)
+	publish("Rack")
+	for _, want := range []string{"3", "4"} {
+		if got := next(); got != want {
+			t.Fatalf("id %s, want %s", got, want)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+// Package server exposes the configured switches over a small HTTP API, so
+// several consumers share one poller and one client per switch instead of
+// each connecting to the device themselves.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+	"github.com/SiirRandall/tesmart-ui/internal/events"
+	"github.com/SiirRandall/tesmart-ui/internal/protocol"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+)
+
+type Server struct {
+	cfg    *config.Config
+	devs   []*device.Device
+	events *events.Bus
+
+	mu sync.RWMutex // guards devs and serialises port edits
+}
+
+// New serves devs. Whoever owns the devices runs their pollers: the serve
+// command calls Start, the GUI polls them itself.
+func New(cfg *config.Config, devs []*device.Device, bus *events.Bus) *Server {
+	return &Server{cfg: cfg, devs: devs, events: bus}
+}
+
+// Start runs a poller per device; results are served from GET /state.
+func (s *Server) Start() {
+	for _, d := range s.devices() {
+		d.Start(device.Handlers{})
+	}
+}
+
+// Close stops the pollers and drops device connections.
+func (s *Server) Close() {
+	for _, d := range s.devices() {
+		d.Close()
+	}
+}
+
+// SetDevices replaces the served devices after switches are added or removed.
+func (s *Server) SetDevices(devs []*device.Device) {
+	s.mu.Lock()
+	s.devs = devs
+	s.mu.Unlock()
+}
+
+func (s *Server) devices() []*device.Device {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.devs
+}
+
+// Handler returns the API routes.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /devices", s.handleDevices)
+	mux.HandleFunc("GET /state", s.withDevice("state", s.handleState))
+	mux.HandleFunc("GET /events", s.handleEvents)
+	mux.HandleFunc("POST /input/{n}", s.withDevice("input", s.handleInput))
+	mux.HandleFunc("GET /network", s.withDevice("network", s.handleGetNetwork))
+	mux.HandleFunc("PUT /network", s.withDevice("network", s.handlePutNetwork))
+	mux.HandleFunc("POST /buzzer", s.withDevice("buzzer", s.handleBuzzer))
+	mux.HandleFunc("POST /led", s.withDevice("led", s.handleLED))
+	mux.HandleFunc("GET /ports", s.withDevice("ports", s.handleGetPorts))
+	mux.HandleFunc("PUT /ports", s.withDevice("ports", s.handlePutPorts))
+	return mux
+}
+
+/* Plumbing */
+
+// badRequest is an error in the request rather than with the device.
+type badRequest struct{ msg string }
+
+func (e badRequest) Error() string { return e.msg }
+
+func badRequestf(format string, args ...any) error {
+	return badRequest{fmt.Sprintf(format, args...)}
+}
+
+type deviceHandler func(r *http.Request, d *device.Device, res *schema.Result) error
+
+// withDevice resolves ?device=NAME (default: the first switch), runs h and
+// writes the result envelope with a status code matching the outcome.
+func (s *Server) withDevice(command string, h deviceHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := schema.New(command)
+		d := s.lookup(r.URL.Query().Get("device"))
+		if d == nil {
+			res.Error = &schema.Error{Kind: schema.KindNotFound, Message: "no such device: " + r.URL.Query().Get("device")}
+			writeJSON(w, http.StatusNotFound, res)
+			return
+		}
+		res.Device, res.Target = d.Name(), d.Config().Target()
+		err := h(r, d, res)
+		writeJSON(w, statusFor(err, res), res)
+	}
+}
+
+func (s *Server) lookup(name string) *device.Device {
+	devs := s.devices()
+	if name == "" && len(devs) > 0 {
+		return devs[0]
+	}
+	for _, d := range devs {
+		if d.Name() == name {
+			return d
+		}
+	}
+	return nil
+}
+
+func statusFor(err error, res *schema.Result) int {
+	var br badRequest
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.As(err, &br):
+		res.Error = &schema.Error{Kind: schema.KindUsage, Message: br.msg}
+		return http.StatusBadRequest
+	}
+	res.Error = schema.NewError(err)
+	switch res.Error.Kind {
+	case schema.KindInputRange:
+		return http.StatusBadRequest
+	case schema.KindTimeout, schema.KindCancelled:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func readJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return badRequestf("invalid JSON body: %v", err)
+	}
+	return nil
+}
+
+// requestContext bounds device work by the request and the device's poller.
+func requestContext(r *http.Request, d *device.Device) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(r.Context())
+	stop := context.AfterFunc(d.Context(), cancel)
+	return ctx, func() { stop(); cancel() }
+}
+
+/* Handlers */
+
+func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
+	res := schema.New("devices")
+	for _, d := range s.devices() {
+		dc := d.Config()
+		res.Devices = append(res.Devices, schema.Device{
+			Name:   dc.Name,
+			Target: dc.Target(),
+			Model:  dc.Model,
+			Ports:  dc.PortCount(),
+		})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) handleState(r *http.Request, d *device.Device, res *schema.Result) error {
+	st := d.State()
+	res.State = &schema.State{Online: st.Online, Link: st.Link.String(), Updated: st.Updated}
+	if st.Active > 0 {
+		res.State.Active = &schema.Input{Port: st.Active, Name: d.Config().InputName(st.Active)}
+	}
+	if !st.Online && st.Err != nil {
+		res.State.Error = schema.NewError(st.Err)
+	}
+	return nil
+}
+
+func (s *Server) handleInput(r *http.Request, d *device.Device, res *schema.Result) error {
+	dc := d.Config()
+	port, err := dc.ResolveInput(r.PathValue("n"))
+	if err != nil {
+		return badRequestf("%v", err)
+	}
+	ctx, cancel := requestContext(r, d)
+	defer cancel()
+	verify := s.cfg.VerifySwitch()
+	sr, err := d.SwitchContext(ctx, port, verify, schema.SourceAPI)
+	if err != nil {
+		return err
+	}
+	res.Switch = &schema.Switch{Active: schema.Input{Port: port, Name: dc.InputName(port)}, Result: schema.SwitchSent}
+	switch sr {
+	case device.Verified:
+		res.Switch.Result = schema.SwitchVerified
+	case device.Unverified:
+		res.Switch.Result = schema.SwitchUnverified
+	}
+	return nil
+}
+
+func (s *Server) handleGetNetwork(r *http.Request, d *device.Device, res *schema.Result) error {
+	ctx, cancel := requestContext(r, d)
+	defer cancel()
+	nc, err := d.Cli.GetNetworkConfigASCIIContext(ctx)
+	if err != nil {
+		return err
+	}
+	res.NetConfig = schema.NewNetConfig(nc, false)
+	return nil
+}
+
+// handlePutNetwork applies the given fields; omitted ones keep their values.
+func (s *Server) handlePutNetwork(r *http.Request, d *device.Device, res *schema.Result) error {
+	var body struct {
+		IP      *string `json:"ip"`
+		Port    *int    `json:"port"`
+		Mask    *string `json:"mask"`
+		Gateway *string `json:"gateway"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		return err
+	}
+	if body.Port != nil && (*body.Port < 1 || *body.Port > 65535) {
+		return badRequestf("invalid port %d", *body.Port)
+	}
+	for name, v := range map[string]*string{"ip": body.IP, "mask": body.Mask, "gateway": body.Gateway} {
+		if v != nil && net.ParseIP(*v).To4() == nil {
+			return badRequestf("invalid %s %q (want a dotted IPv4 address)", name, *v)
+		}
+	}
+	ctx, cancel := requestContext(r, d)
+	defer cancel()
+	nc, err := d.Cli.GetNetworkConfigASCIIContext(ctx)
+	if err != nil {
+		return err
+	}
+	if body.IP != nil {
+		nc.IP = *body.IP
+	}
+	if body.Port != nil {
+		nc.Port = *body.Port
+	}
+	if body.Mask != nil {
+		nc.Mask = *body.Mask
+	}
+	if body.Gateway != nil {
+		nc.GW = *body.Gateway
+	}
+	if err := d.Cli.SetNetworkConfigASCIIContext(ctx, nc.IP, nc.Port, nc.Mask, nc.GW); err != nil {
+		return err
+	}
+	res.NetConfig = schema.NewNetConfig(nc, true)
+	return nil
+}
+
+func (s *Server) handleBuzzer(r *http.Request, d *device.Device, res *schema.Result) error {
+	var body struct {
+		On *bool `json:"on"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		return err
+	}
+	if body.On == nil {
+		return badRequestf(`body must be {"on": true|false}`)
+	}
+	ctx, cancel := requestContext(r, d)
+	defer cancel()
+	if err := d.Cli.SetBuzzerContext(ctx, *body.On); err != nil {
+		return err
+	}
+	res.Setting = &schema.Setting{Name: "buzzer", Value: map[bool]string{true: "on", false: "off"}[*body.On]}
+	return nil
+}
+
+func (s *Server) handleLED(r *http.Request, d *device.Device, res *schema.Result) error {
+	var body struct {
+		Timeout string `json:"timeout"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		return err
+	}
+	m, ok := protocol.ParseLEDTimeout(body.Timeout)
+	if !ok {
+		return badRequestf(`body must be {"timeout": "off"|"10s"|"30s"}`)
+	}
+	ctx, cancel := requestContext(r, d)
+	defer cancel()
+	if err := d.Cli.SetLEDTimeoutContext(ctx, m); err != nil {
+		return err
+	}
+	res.Setting = &schema.Setting{Name: "led_timeout", Value: body.Timeout}
+	return nil
+}
+
+func (s *Server) handleGetPorts(r *http.Request, d *device.Device, res *schema.Result) error {
+	res.Ports = portList(d.Config())
+	return nil
+}
+
+// handlePutPorts updates the names/icons of the listed inputs and saves the
+// config. Inputs not listed are left alone.
+func (s *Server) handlePutPorts(r *http.Request, d *device.Device, res *schema.Result) error {
+	var body []schema.Port
+	if err := readJSON(r, &body); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dc := d.Config()
+	n := dc.PortCount()
+	for _, p := range body {
+		if p.Port < 1 || p.Port > n {
+			return badRequestf("port %d out of range 1..%d", p.Port, n)
+		}
+	}
+	for _, p := range body {
+		pm := dc.Ports[p.Port]
+		pm.Name, pm.Icon = p.Name, p.Icon
+		dc.Ports[p.Port] = pm
+	}
+	d.SetConfig(dc)
+	if err := s.cfg.Save(); err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+	s.events.Publish(schema.Event{Type: schema.EventConfigChanged, Device: d.Name(), What: "ports"})
+	res.Ports = portList(dc)
+	return nil
+}
+
+func portList(dc *config.Device) []schema.Port {
+	out := make([]schema.Port, 0, dc.PortCount())
+	for i := 1; i <= dc.PortCount(); i++ {
+		out = append(out, schema.Port{Port: i, Name: dc.Ports[i].Name, Icon: dc.Ports[i].Icon})
+	}
+	return out
+}
@@ -0,0 +1,116 @@
+package simulator
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/protocol"
+)
+
+// Faults makes the simulator misbehave the way flaky hardware and networks do.
+// The zero value is a well-behaved device.
+type Faults struct {
+	// Drop swallows this many replies before answering again; -1 drops all.
+	Drop int
+	// Refuse resets this many accepted connections straight away; -1 resets all.
+	Refuse int
+	// Split writes replies one byte per TCP segment.
+	Split bool
+	// Garbage is written in front of every reply.
+	Garbage []byte
+	// NULPad appends this many NUL bytes to every reply.
+	NULPad int
+	// Delay holds every reply back for this long.
+	Delay time.Duration
+	// Stale sends the previous status frame in front of every status reply,
+	// as a device that is one answer behind would.
+	Stale bool
+}
+
+// SetFaults replaces the active fault configuration.
+func (d *Device) SetFaults(f Faults) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.faults = f
+}
+
+// Faults returns the active fault configuration, with counters as consumed so far.
+func (d *Device) Faults() Faults {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.faults
+}
+
+// refuse reports whether a freshly accepted connection should be reset.
+// Streams served with ServeConn are never refused.
+func (d *Device) refuse(conn io.ReadWriteCloser) bool {
+	if _, ok := conn.(net.Conn); !ok {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case d.faults.Refuse == 0:
+		return false
+	case d.faults.Refuse > 0:
+		d.faults.Refuse--
+	}
+	if tc, ok := conn.(*net.TCPConn); ok {
+		_ = tc.SetLinger(0) // close with RST rather than FIN
+	}
+	return true
+}
+
+// shape applies the reply-side faults and returns the bytes to write, or nil
+// if the reply is dropped.
+func (d *Device) shape(reply []byte) ([]byte, Faults) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f := d.faults
+	switch {
+	case f.Drop < 0:
+		return nil, f
+	case f.Drop > 0:
+		d.faults.Drop--
+		return nil, f
+	}
+
+	out := append([]byte{}, f.Garbage...)
+	if isStatusFrame(reply) {
+		if f.Stale && d.lastReported > 0 {
+			out = append(out, statusFrame(d.lastReported)...)
+		}
+		d.lastReported = int(reply[4]) + 1
+	}
+	out = append(out, reply...)
+	out = append(out, make([]byte, f.NULPad)...)
+	return out, f
+}
+
+func isStatusFrame(b []byte) bool {
+	f := protocol.Frames(b)
+	return len(b) == protocol.FrameLen && len(f) == 1 && f[0].Cmd == protocol.CmdStatus
+}
+
+// write sends one reply with faults applied.
+func (d *Device) write(conn io.Writer, reply []byte) error {
+	out, f := d.shape(reply)
+	if out == nil {
+		return nil
+	}
+	if f.Delay > 0 {
+		time.Sleep(f.Delay)
+	}
+	if !f.Split {
+		_, err := conn.Write(out)
+		return err
+	}
+	for i := range out {
+		if _, err := conn.Write(out[i : i+1]); err != nil {
+			return err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return nil
+}
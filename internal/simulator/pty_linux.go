@@ -0,0 +1,54 @@
+//go:build linux
+
+package simulator
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// ServePTY creates a pseudo-terminal pair, serves the switch on its master
+// side in the background and returns the path of the slave, which clients
+// open like a USB-serial adapter (e.g. /dev/pts/3).
+func (d *Device) ServePTY() (string, error) {
+	// Non-blocking, so Close interrupts a pending read of the master.
+	fd, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return "", &os.PathError{Op: "open", Path: "/dev/ptmx", Err: err}
+	}
+	master := os.NewFile(uintptr(fd), "/dev/ptmx")
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		_ = master.Close()
+		return "", fmt.Errorf("unlock pty: %w", err)
+	}
+	n, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err != nil {
+		_ = master.Close()
+		return "", fmt.Errorf("pty number: %w", err)
+	}
+	path := fmt.Sprintf("/dev/pts/%d", n)
+
+	// Hold the slave open ourselves: with no slave open the master reads EIO,
+	// which would end the session every time a client closes the port.
+	slave, err := os.OpenFile(path, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		_ = master.Close()
+		return "", err
+	}
+	if t, err := unix.IoctlGetTermios(int(slave.Fd()), unix.TCGETS); err == nil {
+		t.Iflag &^= unix.ICRNL | unix.IXON
+		t.Oflag &^= unix.OPOST
+		t.Lflag &^= unix.ECHO | unix.ICANON | unix.ISIG | unix.IEXTEN
+		_ = unix.IoctlSetTermios(int(slave.Fd()), unix.TCSETS, t)
+	}
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer slave.Close()
+		d.ServeConn(master)
+	}()
+	return path, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package simulator
+
+import "errors"
+
+// ServePTY is only available on Linux.
+func (d *Device) ServePTY() (string, error) {
+	return "", errors.New("pseudo-terminal simulation is only supported on Linux")
+}
@@ -0,0 +1,346 @@
+// Package simulator emulates a TESmart network KVM switch on a TCP port (or a
+// pseudo-terminal, for the serial transport) so the client and UI can be
+// exercised without hardware.
+package simulator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/SiirRandall/tesmart-ui/internal/protocol"
+)
+
+// State is the device state kept by the simulator.
+type State struct {
+	Active     int  // 1-based active input
+	Buzzer     bool // true = buzzer enabled
+	LEDTimeout byte // 0x00 off, 0x0A 10s, 0x1E 30s
+	Ports      int  // number of inputs the device exposes
+	Push       bool // announce front-panel changes on every connection, as some firmware does
+
+	IP   string
+	Port int
+	Mask string
+	GW   string
+}
+
+// DefaultState mirrors a factory-reset 16-port unit.
+func DefaultState() State {
+	return State{
+		Active: 1,
+		Buzzer: true,
+		Ports:  16,
+		IP:     "192.168.1.10",
+		Port:   5000,
+		Mask:   "255.255.255.0",
+		GW:     "192.168.1.1",
+	}
+}
+
+type Device struct {
+	mu    sync.Mutex
+	state State
+
+	faults       Faults
+	lastReported int // input in the last status frame sent
+
+	ln     net.Listener
+	conns  map[io.ReadWriteCloser]struct{}
+	closed bool
+	wg     sync.WaitGroup
+
+	// Logf, if set, receives a line per handled command.
+	Logf func(format string, args ...any)
+}
+
+func New(st State) *Device {
+	if st.Ports <= 0 {
+		st.Ports = 16
+	}
+	if st.Active < 1 || st.Active > st.Ports {
+		st.Active = 1
+	}
+	return &Device{state: st, conns: map[io.ReadWriteCloser]struct{}{}}
+}
+
+// Listen binds addr (e.g. "127.0.0.1:0") and serves in the background.
+func (d *Device) Listen(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.ln = ln
+	d.mu.Unlock()
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		_ = d.Serve(ln)
+	}()
+	return nil
+}
+
+// Addr returns the listening address, or nil before Listen.
+func (d *Device) Addr() net.Addr {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.ln == nil {
+		return nil
+	}
+	return d.ln.Addr()
+}
+
+// Serve accepts connections on ln until it is closed.
+func (d *Device) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			d.mu.Lock()
+			closed := d.closed
+			d.mu.Unlock()
+			if closed || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		d.mu.Lock()
+		d.conns[conn] = struct{}{}
+		d.mu.Unlock()
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.handle(conn)
+		}()
+	}
+}
+
+// ServeConn answers commands on a single stream, such as the master side of
+// a pseudo-terminal standing in for the switch's RS-232 port. It returns
+// when rw is closed.
+func (d *Device) ServeConn(rw io.ReadWriteCloser) {
+	d.mu.Lock()
+	d.conns[rw] = struct{}{}
+	d.mu.Unlock()
+	d.wg.Add(1)
+	defer d.wg.Done()
+	d.handle(rw)
+}
+
+// Close stops the listener, drops open connections and waits for handlers.
+func (d *Device) Close() error {
+	d.mu.Lock()
+	d.closed = true
+	var err error
+	if d.ln != nil {
+		err = d.ln.Close()
+	}
+	for c := range d.conns {
+		_ = c.Close()
+	}
+	d.mu.Unlock()
+	d.wg.Wait()
+	return err
+}
+
+// State returns a snapshot of the device state.
+func (d *Device) State() State {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.state
+}
+
+// SetActive changes the active input as if the front panel had been used.
+func (d *Device) SetActive(n int) error {
+	d.mu.Lock()
+	if n < 1 || n > d.state.Ports {
+		d.mu.Unlock()
+		return fmt.Errorf("input out of range: %d", n)
+	}
+	var push []io.ReadWriteCloser
+	if d.state.Push && n != d.state.Active {
+		for c := range d.conns {
+			push = append(push, c)
+		}
+	}
+	d.state.Active = n
+	d.mu.Unlock()
+	for _, c := range push {
+		_, _ = c.Write(statusFrame(n))
+	}
+	return nil
+}
+
+func (d *Device) logf(format string, args ...any) {
+	if d.Logf != nil {
+		d.Logf(format, args...)
+	} else {
+		log.Printf("[sim] "+format, args...)
+	}
+}
+
+/* Connection handling */
+
+func (d *Device) handle(conn io.ReadWriteCloser) {
+	defer func() {
+		d.mu.Lock()
+		delete(d.conns, conn)
+		d.mu.Unlock()
+		_ = conn.Close()
+	}()
+	if d.refuse(conn) {
+		return
+	}
+
+	var buf []byte
+	tmp := make([]byte, 256)
+	for {
+		n, err := conn.Read(tmp)
+		if n > 0 {
+			buf = append(buf, tmp[:n]...)
+			var replies [][]byte
+			buf, replies = d.process(buf)
+			for _, r := range replies {
+				if err := d.write(conn, r); err != nil {
+					return
+				}
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// process consumes complete commands from buf and returns the remainder along
+// with the replies to send, in order.
+func (d *Device) process(buf []byte) ([]byte, [][]byte) {
+	var replies [][]byte
+	for len(buf) > 0 {
+		switch {
+		case buf[0] == 0xAA:
+			if len(buf) < 6 {
+				if !bytes.HasPrefix([]byte{0xAA, 0xBB, 0x03}, buf[:min(len(buf), 3)]) {
+					buf = buf[1:]
+					continue
+				}
+				return buf, replies
+			}
+			if buf[1] != 0xBB || buf[2] != 0x03 || buf[5] != 0xEE {
+				buf = buf[1:]
+				continue
+			}
+			if r := d.binary(buf[3], buf[4]); r != nil {
+				replies = append(replies, r)
+			}
+			buf = buf[6:]
+		case isASCIIStart(buf[0]):
+			end := bytes.IndexAny(buf, "?;")
+			if end < 0 {
+				if len(buf) > 64 {
+					buf = buf[1:]
+					continue
+				}
+				return buf, replies
+			}
+			if r := d.ascii(string(buf[:end+1])); r != nil {
+				replies = append(replies, r)
+			}
+			buf = buf[end+1:]
+		default:
+			buf = buf[1:]
+		}
+	}
+	return buf, replies
+}
+
+func isASCIIStart(b byte) bool { return b >= 'A' && b <= 'Z' }
+
+func statusFrame(active int) []byte {
+	return protocol.Status{Active: active}.Frame().Bytes()
+}
+
+func (d *Device) binary(cmd, arg byte) []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch cmd {
+	case protocol.CmdSwitch: // 1-based
+		if int(arg) >= 1 && int(arg) <= d.state.Ports {
+			d.state.Active = int(arg)
+			d.logf("switch → %d", arg)
+		}
+		return statusFrame(d.state.Active)
+	case protocol.CmdStatus: // switch, 0-based
+		if int(arg) < d.state.Ports {
+			d.state.Active = int(arg) + 1
+			d.logf("switch (0x11) → %d", d.state.Active)
+		}
+		return statusFrame(d.state.Active)
+	case protocol.CmdQuery:
+		return statusFrame(d.state.Active)
+	case protocol.CmdBuzzer:
+		d.state.Buzzer = arg != 0
+		d.logf("buzzer → %v", d.state.Buzzer)
+	case protocol.CmdLEDTimeout:
+		d.state.LEDTimeout = arg
+		d.logf("led timeout → %d", arg)
+	default:
+		d.logf("unknown command %02X %02X", cmd, arg)
+	}
+	return nil
+}
+
+func padIP(s string) string {
+	parts := strings.Split(s, ".")
+	for i, p := range parts {
+		if n, err := strconv.Atoi(p); err == nil {
+			parts[i] = fmt.Sprintf("%03d", n)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func (d *Device) ascii(cmd string) []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch cmd {
+	case "IP?":
+		return []byte("IP:" + padIP(d.state.IP) + ";")
+	case "PT?":
+		return []byte(fmt.Sprintf("PT:%d;", d.state.Port))
+	case "MA?":
+		return []byte("MA:" + padIP(d.state.Mask) + ";")
+	case "GW?":
+		return []byte("GW:" + padIP(d.state.GW) + ";")
+	}
+	key, val, ok := strings.Cut(strings.TrimSuffix(cmd, ";"), ":")
+	if !ok {
+		d.logf("unknown ascii %q", cmd)
+		return nil
+	}
+	switch key {
+	case "IP":
+		d.state.IP = val
+	case "PT":
+		p, err := strconv.Atoi(val)
+		if err != nil || p <= 0 || p > 65535 {
+			return []byte("ERR")
+		}
+		d.state.Port = p
+	case "MA":
+		d.state.Mask = val
+	case "GW":
+		d.state.GW = val
+	default:
+		d.logf("unknown ascii %q", cmd)
+		return nil
+	}
+	d.logf("%s → %s", key, val)
+	return []byte("OK")
+}
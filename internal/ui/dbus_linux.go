@@ -0,0 +1,20 @@
+//go:build linux
+
+package ui
+
+import (
+	"log"
+
+	"github.com/SiirRandall/tesmart-ui/internal/dbus"
+)
+
+// startDBus exports the session bus service. Without a session bus (e.g.
+// over SSH) it logs and does nothing.
+func (u *AppUI) startDBus() {
+	svc := dbus.New(u.cfg, u.Device, u.events)
+	if err := svc.Start(); err != nil {
+		log.Printf("[dbus] %v", err)
+		return
+	}
+	u.dbus = svc
+}
@@ -0,0 +1,6 @@
+//go:build !linux
+
+package ui
+
+// The D-Bus service is Linux only.
+func (u *AppUI) startDBus() {}
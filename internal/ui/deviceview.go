@@ -0,0 +1,135 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/SiirRandall/tesmart-ui/internal/client"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+	"github.com/SiirRandall/tesmart-ui/internal/widgets"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+// deviceView is the tab for one switch: its tile grid and status line.
+type deviceView struct {
+	u      *AppUI
+	dev    *device.Device
+	grid   *fyne.Container
+	tiles  map[int]*widgets.PortTile
+	status *widget.Label
+	tab    *container.TabItem
+}
+
+func newDeviceView(u *AppUI, d *device.Device) *deviceView {
+	v := &deviceView{
+		u:      u,
+		dev:    d,
+		grid:   container.New(layout.NewGridWrapLayout(fyne.NewSize(170, 140))),
+		status: widget.NewLabel("Connected to " + d.Config().Target()),
+	}
+	v.buildTiles()
+	v.tab = container.NewTabItem(d.Name(), container.NewBorder(nil, v.status, nil, nil, v.grid))
+	return v
+}
+
+// buildTiles (re)creates one tile per input of the device's model.
+func (v *deviceView) buildTiles() {
+	v.grid.RemoveAll()
+	v.tiles = map[int]*widgets.PortTile{}
+	cfg := v.dev.Config()
+	for i := 1; i <= cfg.PortCount(); i++ {
+		meta := cfg.Ports[i]
+		iconRes := loadIcon(v.u.cfg.Dir(), meta.Icon)
+		port := i
+		t := widgets.NewPortTile(port, meta.Name, iconRes, func() {
+			v.setActiveHighlight(port)
+			go v.switchTo(port)
+		})
+		t.SetOffline(v.dev.State().Link == device.LinkOffline)
+		v.tiles[i] = t
+		v.grid.Add(container.NewPadded(t))
+	}
+	v.grid.Refresh()
+}
+
+// applyConfig pushes settings passed to SetConfig to the client and rebuilds
+// everything that depends on the name or port count.
+func (v *deviceView) applyConfig() {
+	v.dev.Apply()
+	v.buildTiles()
+	v.tab.Text = v.dev.Name()
+	v.u.tabs.Refresh()
+	v.u.win.SetTitle(v.u.windowTitle())
+	v.u.refreshTray()
+}
+
+// setStatus may be called from any goroutine.
+func (v *deviceView) setStatus(text string) {
+	fyne.Do(func() { v.status.SetText(text) })
+}
+
+/* Polling + switching */
+
+func (v *deviceView) start() {
+	v.dev.SetSuppress(v.u.cfg.SwitchSuppress())
+	v.dev.Start(device.Handlers{
+		OnActive: func(port int) {
+			fyne.Do(func() {
+				v.setActiveHighlight(port)
+				v.status.SetText(fmt.Sprintf("Active: %d", port))
+			})
+		},
+		OnError: func(err error) {
+			st := v.dev.State()
+			if st.Link == device.LinkOffline {
+				v.setStatus(fmt.Sprintf("Offline: %s — retrying in %v", client.Hint(err), st.Backoff))
+				return
+			}
+			v.setStatus("Polling error: " + client.Hint(err))
+		},
+		OnLink: func(from, to device.Link) { fyne.Do(func() { v.onLink(from, to) }) },
+	})
+}
+
+// onLink greys the tiles out while the switch is offline and notifies once
+// per change, except for the first poll's result.
+func (v *deviceView) onLink(from, to device.Link) {
+	for _, t := range v.tiles {
+		t.SetOffline(to == device.LinkOffline)
+	}
+	if from == device.LinkUnknown || !v.u.trayEnabled {
+		return
+	}
+	n := map[device.Link]fyne.Notification{
+		device.LinkOnline:   {Title: "Switch Online", Content: "%s is back online."},
+		device.LinkDegraded: {Title: "Switch Not Responding", Content: "%s is not answering reliably."},
+		device.LinkOffline:  {Title: "Switch Offline", Content: "%s is offline; retrying less often."},
+	}[to]
+	n.Content = fmt.Sprintf(n.Content, v.dev.Name())
+	v.u.app.SendNotification(&n)
+}
+
+func (v *deviceView) switchTo(port int) {
+	cfg := v.u.cfg
+	res, err := v.dev.Switch(port, cfg.VerifySwitch(), schema.SourceUI)
+	switch {
+	case err != nil:
+		v.setStatus("Switch failed: " + client.Hint(err))
+	case cfg.FastMode:
+		v.setStatus(fmt.Sprintf("Switched (fast) → %d", port))
+	case res == device.Unverified:
+		v.setStatus("Switched (unverified) — will sync on next poll")
+	default:
+		v.setStatus(fmt.Sprintf("Switched to input %d", port))
+	}
+}
+
+func (v *deviceView) setActiveHighlight(n int) {
+	for i, t := range v.tiles {
+		t.SetSelected(i == n)
+	}
+}
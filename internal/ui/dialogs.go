@@ -2,13 +2,17 @@ package ui
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/SiirRandall/tesmart-ui/internal/client"
 	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+	"github.com/SiirRandall/tesmart-ui/internal/discovery"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -22,7 +26,7 @@ import (
 
 func (u *AppUI) showAbout() {
 	dialog.ShowInformation("About",
-		"TeSmart 16-Port GUI (Go/Fyne)\n\n• Input switching, ping, buzzer, LED timeout, raw hex\n• Network Config via ASCII (IP?/PT?/MA?/GW?)\n\nConfig: "+u.cfg.Path(),
+		"TeSmart UI (Go/Fyne) — "+u.current().dev.Config().Profile().Title()+"\n\n• Input switching, ping, buzzer, LED timeout, raw hex\n• Network Config via ASCII (IP?/PT?/MA?/GW?)\n\nConfig: "+u.cfg.Path(),
 		u.win)
 }
 
@@ -43,52 +47,301 @@ func loadIcon(cfgDir, rel string) fyne.Resource {
 
 /* Connection */
 
+// newModelSelect offers the known models, preselecting id.
+func newModelSelect(id string) *widget.Select {
+	names := make([]string, len(config.Models))
+	for i, m := range config.Models {
+		names[i] = m.Name
+	}
+	sel := widget.NewSelect(names, nil)
+	if m, ok := config.LookupModel(id); ok {
+		sel.SetSelected(m.Name)
+	} else {
+		sel.SetSelectedIndex(len(names) - 1)
+	}
+	return sel
+}
+
 func (u *AppUI) showConnectionDialog() {
+	v := u.current()
+	cfg := v.dev.Config()
+
+	nameEntry := widget.NewEntry()
+	nameEntry.SetText(cfg.Name)
+
 	ipEntry := widget.NewEntry()
 	ipEntry.SetPlaceHolder("e.g., 192.168.1.10")
-	ipEntry.SetText(u.cfg.IP)
+	ipEntry.SetText(cfg.IP)
 
 	portEntry := widget.NewEntry()
 	portEntry.SetPlaceHolder("5000")
-	portEntry.SetText(strconv.Itoa(u.cfg.Port))
+	portEntry.SetText(strconv.Itoa(cfg.Port))
+
+	serialEntry := widget.NewEntry()
+	serialEntry.SetPlaceHolder("e.g., /dev/ttyUSB0")
+	serialEntry.SetText(cfg.Serial.Path)
+
+	baudSelect := widget.NewSelect([]string{"1200", "2400", "4800", "9600", "19200", "38400", "57600", "115200"}, nil)
+	baudSelect.SetSelected(strconv.Itoa(cfg.Serial.Baud))
+
+	framingSelect := widget.NewSelect([]string{"8N1", "8E1", "8O1", "7E1", "7O1", "8N2"}, nil)
+	framingSelect.SetSelected(cfg.Serial.Framing)
+
+	transportRadio := widget.NewRadioGroup([]string{"TCP", "Serial"}, func(sel string) {
+		for _, w := range []fyne.Disableable{ipEntry, portEntry} {
+			if sel == "Serial" {
+				w.Disable()
+			} else {
+				w.Enable()
+			}
+		}
+		for _, w := range []fyne.Disableable{serialEntry, baudSelect, framingSelect} {
+			if sel == "Serial" {
+				w.Enable()
+			} else {
+				w.Disable()
+			}
+		}
+	})
+	transportRadio.Horizontal = true
+	if cfg.IsSerial() {
+		transportRadio.SetSelected("Serial")
+	} else {
+		transportRadio.SetSelected("TCP")
+	}
+
+	listenCheck := widget.NewCheck("Listen for front-panel changes", nil)
+	listenCheck.SetChecked(cfg.Listen)
+	persistCheck := widget.NewCheck("Keep one connection open", func(on bool) {
+		if on {
+			listenCheck.Enable()
+		} else {
+			listenCheck.Disable()
+		}
+	})
+	persistCheck.SetChecked(cfg.PersistentConn)
+	if !cfg.PersistentConn {
+		listenCheck.Disable()
+	}
+
+	adaptiveCheck := widget.NewCheck("Learn from measured round trips", nil)
+	adaptiveCheck.SetChecked(cfg.AdaptiveTimeout)
+	learned := widget.NewLabel(timeoutsText(v.dev.Cli.Timeouts()))
+
+	modelSelect := newModelSelect(cfg.Model)
+
+	cascadeEntry := widget.NewEntry()
+	cascadeEntry.SetPlaceHolder("1")
+	cascadeEntry.SetText(strconv.Itoa(cfg.Profile().Units))
 
 	form := &widget.Form{
 		Items: []*widget.FormItem{
+			{Text: "Name", Widget: nameEntry},
+			{Text: "Transport", Widget: transportRadio},
 			{Text: "App → KVM IP", Widget: ipEntry},
 			{Text: "App → KVM Port", Widget: portEntry},
+			{Text: "Serial device", Widget: serialEntry},
+			{Text: "Baud rate", Widget: baudSelect},
+			{Text: "Framing", Widget: framingSelect},
+			{Text: "Session", Widget: container.NewVBox(persistCheck, listenCheck)},
+			{Text: "Timeouts", Widget: container.NewVBox(adaptiveCheck, learned)},
+			{Text: "Model", Widget: modelSelect},
+			{Text: "Cascaded units", Widget: cascadeEntry},
 		},
 		OnSubmit: func() {
+			serial := transportRadio.Selected == "Serial"
 			ip := strings.TrimSpace(ipEntry.Text)
 			p, err := strconv.Atoi(strings.TrimSpace(portEntry.Text))
-			if err != nil || p < 1 || p > 65535 {
+			if !serial && (err != nil || p < 1 || p > 65535) {
 				dialog.ShowError(fmt.Errorf("invalid port"), u.win)
 				return
 			}
-			if ip == "" {
+			if !serial && ip == "" {
 				dialog.ShowError(fmt.Errorf("IP address cannot be empty"), u.win)
 				return
 			}
-			u.cfg.IP, u.cfg.Port = ip, p
+			path := strings.TrimSpace(serialEntry.Text)
+			if serial && path == "" {
+				dialog.ShowError(fmt.Errorf("serial device cannot be empty"), u.win)
+				return
+			}
+			baud, _ := strconv.Atoi(baudSelect.Selected)
+			if _, err := client.NewSerial(path, baud, framingSelect.Selected); serial && err != nil {
+				dialog.ShowError(err, u.win)
+				return
+			}
+			name := strings.TrimSpace(nameEntry.Text)
+			if other := u.cfg.Device(name); name == "" || (other != nil && name != v.dev.Name()) {
+				dialog.ShowError(fmt.Errorf("switch names must be unique and non-empty"), u.win)
+				return
+			}
+			units, err := strconv.Atoi(strings.TrimSpace(cascadeEntry.Text))
+			if err != nil || units < 1 {
+				dialog.ShowError(fmt.Errorf("cascaded units must be 1 or more"), u.win)
+				return
+			}
+			model := config.Models[modelSelect.SelectedIndex()]
+			if model.Ports*units > config.MaxPorts {
+				dialog.ShowError(fmt.Errorf("at most %d inputs are addressable", config.MaxPorts), u.win)
+				return
+			}
+			cfg.Name = name
+			if serial {
+				cfg.Transport = "serial"
+				cfg.Serial = config.SerialPort{Path: path, Baud: baud, Framing: framingSelect.Selected}
+			} else {
+				cfg.Transport = "tcp"
+				cfg.IP, cfg.Port = ip, p
+			}
+			cfg.Model, cfg.CascadeUnits = model.ID, units
+			cfg.PersistentConn = persistCheck.Checked
+			cfg.Listen = listenCheck.Checked
+			cfg.AdaptiveTimeout = adaptiveCheck.Checked
+			v.dev.SetConfig(cfg)
 			if err := u.cfg.Save(); err != nil {
 				dialog.ShowError(fmt.Errorf("failed to save config: %v", err), u.win)
 				return
 			}
-			u.cli.SetTarget(u.cfg.IP, u.cfg.Port, u.cfg.GetTimeout(), u.cfg.SetTimeout())
-			u.status.SetText(fmt.Sprintf("Connection updated → %s:%d", ip, p))
-			go u.pollOnce()
+			v.applyConfig()
+			u.configChanged(v, "connection")
+			v.status.SetText("Connection updated → " + cfg.Target())
+			go v.dev.PollOnce()
 		},
 		SubmitText: "Save",
 	}
 	d := dialog.NewCustom("Connection (Client Target)", "Close", form, u.win)
-	d.Resize(fyne.NewSize(520, 340))
+	d.Resize(fyne.NewSize(520, 560))
+
+	// The learned deadlines move with every poll; keep them current while
+	// the dialog is open.
+	tick := time.NewTicker(time.Second)
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-tick.C:
+				text := timeoutsText(v.dev.Cli.Timeouts())
+				fyne.Do(func() { learned.SetText(text) })
+			case <-stop:
+				return
+			}
+		}
+	}()
+	d.SetOnClosed(func() {
+		tick.Stop()
+		close(stop)
+	})
+	d.Show()
+}
+
+// timeoutsText describes the deadlines in effect and the measured round trips.
+func timeoutsText(t client.Timeouts) string {
+	mode := "fixed"
+	if t.Adaptive {
+		mode = "adaptive"
+	}
+	s := fmt.Sprintf("Now: get %d ms, set %d ms (%s)", t.Get.Milliseconds(), t.Set.Milliseconds(), mode)
+	if t.GetSamples > 0 || t.SetSamples > 0 {
+		s += fmt.Sprintf("\nMeasured p95: get %s, set %s", rttText(t.GetRTT, t.GetSamples), rttText(t.SetRTT, t.SetSamples))
+	}
+	return s
+}
+
+func rttText(d time.Duration, n int) string {
+	if n == 0 {
+		return "–"
+	}
+	return fmt.Sprintf("%.0f ms (%d)", float64(d.Microseconds())/1000, n)
+}
+
+/* Add / remove switches */
+
+func (u *AppUI) showAddDeviceDialog() {
+	nameEntry := widget.NewEntry()
+	nameEntry.SetPlaceHolder(fmt.Sprintf("Switch %d", len(u.views)+1))
+
+	ipEntry := widget.NewEntry()
+	ipEntry.SetPlaceHolder("e.g., 192.168.1.11")
+
+	portEntry := widget.NewEntry()
+	portEntry.SetPlaceHolder("5000")
+	portEntry.SetText("5000")
+
+	modelSelect := newModelSelect(config.DefaultModel)
+
+	var d dialog.Dialog
+	form := &widget.Form{
+		Items: []*widget.FormItem{
+			{Text: "Name", Widget: nameEntry},
+			{Text: "KVM IP", Widget: ipEntry},
+			{Text: "KVM Port", Widget: portEntry},
+			{Text: "Model", Widget: modelSelect},
+		},
+		OnSubmit: func() {
+			ip := strings.TrimSpace(ipEntry.Text)
+			p, err := strconv.Atoi(strings.TrimSpace(portEntry.Text))
+			if err != nil || p < 1 || p > 65535 {
+				dialog.ShowError(fmt.Errorf("invalid port"), u.win)
+				return
+			}
+			if ip == "" {
+				dialog.ShowError(fmt.Errorf("IP address cannot be empty"), u.win)
+				return
+			}
+			dc := u.cfg.AddDevice(&config.Device{
+				Name:  strings.TrimSpace(nameEntry.Text),
+				IP:    ip,
+				Port:  p,
+				Model: config.Models[modelSelect.SelectedIndex()].ID,
+			})
+			if err := u.cfg.Save(); err != nil {
+				dialog.ShowError(fmt.Errorf("failed to save config: %v", err), u.win)
+				return
+			}
+			v := u.addView(device.New(dc, u.cfg.SwitchSuppress()))
+			v.start()
+			u.configChanged(v, "added")
+			u.tabs.Select(v.tab)
+			u.refreshTray()
+			d.Hide()
+		},
+		SubmitText: "Add",
+	}
+	d = dialog.NewCustom("Add Switch", "Cancel", form, u.win)
+	d.Resize(fyne.NewSize(520, 320))
 	d.Show()
 }
 
+func (u *AppUI) confirmRemoveDevice() {
+	if len(u.views) < 2 {
+		dialog.ShowInformation("Remove Switch", "The last switch cannot be removed.", u.win)
+		return
+	}
+	v := u.current()
+	dialog.ShowConfirm("Remove Switch",
+		fmt.Sprintf("Remove %q and its port names from the config?", v.dev.Name()),
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			u.cfg.RemoveDevice(u.cfg.Device(v.dev.Name()))
+			if err := u.cfg.Save(); err != nil {
+				dialog.ShowError(fmt.Errorf("failed to save config: %v", err), u.win)
+			}
+			u.removeView(v)
+			u.configChanged(v, "removed")
+			u.win.SetTitle(u.windowTitle())
+			u.refreshTray()
+		}, u.win)
+}
+
 /* Edit ports UI */
 
 func (u *AppUI) showEditDialog() {
-	portOptions := make([]string, 16)
-	for i := 1; i <= 16; i++ {
+	v := u.current()
+	cfg := v.dev.Config()
+	portOptions := make([]string, cfg.PortCount())
+	for i := 1; i <= len(portOptions); i++ {
 		portOptions[i-1] = fmt.Sprintf("%d", i)
 	}
 	portSelect := widget.NewSelect(portOptions, nil)
@@ -102,7 +355,7 @@ func (u *AppUI) showEditDialog() {
 
 	prefill := func() {
 		pn, _ := strconv.Atoi(portSelect.Selected)
-		meta := u.cfg.Ports[pn]
+		meta := v.dev.Config().Ports[pn]
 		nameEntry.SetText(meta.Name)
 		iconPathEntry.SetText(meta.Icon)
 	}
@@ -129,16 +382,22 @@ func (u *AppUI) showEditDialog() {
 		},
 		OnSubmit: func() {
 			pn, _ := strconv.Atoi(portSelect.Selected)
-			u.cfg.Ports[pn] = config.PortMeta{Name: nameEntry.Text, Icon: iconPathEntry.Text}
+			dc := v.dev.Config()
+			pm := dc.Ports[pn]
+			pm.Name, pm.Icon = nameEntry.Text, iconPathEntry.Text
+			dc.Ports[pn] = pm
+			v.dev.SetConfig(dc)
 			_ = u.cfg.Save()
+			u.configChanged(v, "ports")
 
 			iconRes := loadIcon(u.cfg.Dir(), iconPathEntry.Text)
-			u.tiles[pn].SetNameIcon(nameEntry.Text, iconRes)
-			u.status.SetText(fmt.Sprintf("Updated Port %d", pn))
+			v.tiles[pn].SetNameIcon(nameEntry.Text, iconRes)
+			u.refreshTray()
+			v.status.SetText(fmt.Sprintf("Updated Port %d", pn))
 		},
 		SubmitText: "Save",
 	}
-	d := dialog.NewCustom("Edit Names / Icons", "Close", form, u.win)
+	d := dialog.NewCustom("Edit Names / Icons — "+cfg.Name, "Close", form, u.win)
 	d.Resize(fyne.NewSize(640, 460))
 	d.Show()
 }
@@ -146,6 +405,7 @@ func (u *AppUI) showEditDialog() {
 /* Network config */
 
 func (u *AppUI) showNetworkConfigDialog() {
+	v := u.current()
 	ipEntry := widget.NewEntry()
 	maskEntry := widget.NewEntry()
 	gwEntry := widget.NewEntry()
@@ -158,7 +418,7 @@ func (u *AppUI) showNetworkConfigDialog() {
 
 	getBtn := widget.NewButton("Get Configuration", func() {
 		go func() {
-			cfgReply, err := u.cli.GetNetworkConfigASCII()
+			cfgReply, err := v.dev.Cli.GetNetworkConfigASCIIContext(v.dev.Context())
 			fyne.DoAndWait(func() {
 				if err != nil {
 					dialog.ShowError(err, u.win)
@@ -168,7 +428,7 @@ func (u *AppUI) showNetworkConfigDialog() {
 				portEntry.SetText(strconv.Itoa(cfgReply.Port))
 				maskEntry.SetText(cfgReply.Mask)
 				gwEntry.SetText(cfgReply.GW)
-				u.status.SetText("Fetched network configuration")
+				v.status.SetText("Fetched network configuration")
 			})
 		}()
 	})
@@ -182,16 +442,22 @@ func (u *AppUI) showNetworkConfigDialog() {
 			dialog.ShowError(fmt.Errorf("invalid port"), u.win)
 			return
 		}
+		for _, a := range []string{ip, mask, gw} {
+			if net.ParseIP(a).To4() == nil {
+				dialog.ShowError(fmt.Errorf("invalid address %q", a), u.win)
+				return
+			}
+		}
 
 		go func() {
-			err := u.cli.SetNetworkConfigASCII(ip, p, mask, gw)
+			err := v.dev.Cli.SetNetworkConfigASCIIContext(v.dev.Context(), ip, p, mask, gw)
 			fyne.DoAndWait(func() {
 				if err != nil {
 					dialog.ShowError(fmt.Errorf("set failed: %v", err), u.win)
 					return
 				}
 
-				u.status.SetText("Network configuration sent")
+				v.status.SetText("Network configuration sent")
 
 				dialog.ShowInformation(
 					"Network Configuration Updated",
@@ -203,12 +469,18 @@ func (u *AppUI) showNetworkConfigDialog() {
 					u.win,
 				)
 
-				// Update local target and persist
-				u.cfg.IP, u.cfg.Port = ip, p
+				// Update local target and persist; a serial link is unaffected.
+				dc := v.dev.Config()
+				if dc.IsSerial() {
+					return
+				}
+				dc.IP, dc.Port = ip, p
+				v.dev.SetConfig(dc)
 				if e := u.cfg.Save(); e == nil {
-					u.cli.SetTarget(u.cfg.IP, u.cfg.Port, u.cfg.GetTimeout(), u.cfg.SetTimeout())
-					u.status.SetText(fmt.Sprintf("Target set to %s:%d (will work after device reboot)", u.cfg.IP, u.cfg.Port))
-					go u.pollOnce()
+					v.dev.Apply()
+					u.configChanged(v, "connection")
+					v.status.SetText(fmt.Sprintf("Target set to %s:%d (will work after device reboot)", ip, p))
+					go v.dev.PollOnce()
 				}
 			})
 		}()
@@ -227,7 +499,7 @@ func (u *AppUI) showNetworkConfigDialog() {
 		container.NewHBox(getBtn, setBtn, layout.NewSpacer()),
 	)
 
-	d := dialog.NewCustom("Device Network Config", "Close", body, u.win)
+	d := dialog.NewCustom("Device Network Config — "+v.dev.Name(), "Close", body, u.win)
 	d.Resize(fyne.NewSize(620, 360))
 	d.Show()
 }
@@ -235,6 +507,7 @@ func (u *AppUI) showNetworkConfigDialog() {
 /* Raw dialog */
 
 func (u *AppUI) showRawDialog() {
+	v := u.current()
 	in := widget.NewEntry()
 	in.SetPlaceHolder("Enter hex frame, e.g. AABB031000EE")
 	out := widget.NewMultiLineEntry()
@@ -250,7 +523,7 @@ func (u *AppUI) showRawDialog() {
 		OnSubmit: func() {
 			hexstr := strings.TrimSpace(in.Text)
 			go func() {
-				reply, err := u.cli.RawHexSend(hexstr, 1200*time.Millisecond)
+				reply, err := v.dev.Cli.RawHexSendContext(v.dev.Context(), hexstr, 1200*time.Millisecond)
 				fyne.Do(func() {
 					if err != nil {
 						dialog.ShowError(err, u.win)
@@ -262,80 +535,87 @@ func (u *AppUI) showRawDialog() {
 		},
 		SubmitText: "Send",
 	}
-	d := dialog.NewCustom("Send Raw Hex", "Close", form, u.win)
+	d := dialog.NewCustom("Send Raw Hex — "+v.dev.Name(), "Close", form, u.win)
 	d.Resize(fyne.NewSize(640, 420))
 	d.Show()
 }
 
 /* Quick device actions */
 
-func (u *AppUI) doPing() {
+func (v *deviceView) doPing() {
+	win := v.u.win
 	start := time.Now()
-	err := u.cli.Ping()
+	err := v.dev.Cli.PingContext(v.dev.Context())
 	lat := time.Since(start)
 	fyne.Do(func() {
 		if err != nil {
-			dialog.ShowError(fmt.Errorf("ping failed: %v", err), u.win)
-			u.status.SetText("Ping failed")
+			dialog.ShowError(fmt.Errorf("ping failed: %v", err), win)
+			v.status.SetText("Ping failed: " + client.Hint(err))
 		} else {
-			dialog.ShowInformation("Ping", fmt.Sprintf("OK in %d ms", lat.Milliseconds()), u.win)
-			u.status.SetText(fmt.Sprintf("Ping OK (%d ms)", lat.Milliseconds()))
+			dialog.ShowInformation("Ping", fmt.Sprintf("OK in %d ms", lat.Milliseconds()), win)
+			v.status.SetText(fmt.Sprintf("Ping OK (%d ms)", lat.Milliseconds()))
 		}
 	})
 }
 
-func (u *AppUI) doBuzzer(on bool) {
-	if err := u.cli.SetBuzzer(on); err != nil {
-		fyne.Do(func() { dialog.ShowError(fmt.Errorf("buzzer command failed: %v", err), u.win) })
+func (v *deviceView) doBuzzer(on bool) {
+	if err := v.dev.Cli.SetBuzzerContext(v.dev.Context(), on); err != nil {
+		fyne.Do(func() { dialog.ShowError(fmt.Errorf("buzzer command failed: %v", err), v.u.win) })
 		return
 	}
 	if on {
-		u.status.SetText("Buzzer unmuted")
+		v.setStatus("Buzzer unmuted")
 	} else {
-		u.status.SetText("Buzzer muted")
+		v.setStatus("Buzzer muted")
 	}
 }
 
-func (u *AppUI) doTimeout(mode string) {
+func (v *deviceView) doTimeout(mode string) {
+	ctx := v.dev.Context()
 	var err error
 	switch mode {
 	case "off":
-		err = u.cli.SetLEDTimeoutOff()
+		err = v.dev.Cli.SetLEDTimeoutOffContext(ctx)
 	case "10s":
-		err = u.cli.SetLEDTimeout10s()
+		err = v.dev.Cli.SetLEDTimeout10sContext(ctx)
 	case "30s":
-		err = u.cli.SetLEDTimeout30s()
+		err = v.dev.Cli.SetLEDTimeout30sContext(ctx)
 	default:
 		err = fmt.Errorf("unknown timeout mode")
 	}
 	if err != nil {
-		fyne.Do(func() { dialog.ShowError(fmt.Errorf("LED timeout failed: %v", err), u.win) })
+		fyne.Do(func() { dialog.ShowError(fmt.Errorf("LED timeout failed: %v", err), v.u.win) })
 		return
 	}
-	u.status.SetText("LED timeout: " + mode)
+	v.setStatus("LED timeout: " + mode)
 }
 
 func (u *AppUI) showFirstSetupDialog() {
+	v := u.views[0]
+	cfg := v.dev.Config()
 	title := widget.NewLabelWithStyle("Welcome to TeSmart UI", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
-	desc := widget.NewLabel("Let's set up your KVM connection. Enter the IP and port of your TESmart switch below.\nYou can change these later from File → Connection…")
+	desc := widget.NewLabel("Let's set up your KVM connection. Pick your model and enter the IP and port of your TESmart\nswitch below, or use Find on Network… to scan for it. You can change these later from File → Connection…")
+
+	modelSelect := newModelSelect(cfg.Model)
 
 	ipEntry := widget.NewEntry()
 	ipEntry.SetPlaceHolder("e.g., 192.168.1.10")
-	if u.cfg.IP != "" {
-		ipEntry.SetText(u.cfg.IP)
+	if cfg.IP != "" {
+		ipEntry.SetText(cfg.IP)
 	} else {
 		ipEntry.SetText("192.168.1.10")
 	}
 
 	portEntry := widget.NewEntry()
 	portEntry.SetPlaceHolder("5000")
-	if u.cfg.Port > 0 {
-		portEntry.SetText(strconv.Itoa(u.cfg.Port))
+	if cfg.Port > 0 {
+		portEntry.SetText(strconv.Itoa(cfg.Port))
 	} else {
 		portEntry.SetText("5000")
 	}
 
 	form := widget.NewForm(
+		widget.NewFormItem("Model", modelSelect),
 		widget.NewFormItem("KVM IP", ipEntry),
 		widget.NewFormItem("KVM Port", portEntry),
 	)
@@ -355,31 +635,49 @@ func (u *AppUI) showFirstSetupDialog() {
 			return
 		}
 
-		u.cfg.IP, u.cfg.Port = ip, p
+		// Another model starts from its own defaults, input names included.
+		if m := config.Models[modelSelect.SelectedIndex()]; m.ID != cfg.Model {
+			def := config.DefaultDevice(m)
+			cfg.Model, cfg.CascadeUnits, cfg.Ports = def.Model, def.CascadeUnits, def.Ports
+		}
+		cfg.IP, cfg.Port = ip, p
+		v.dev.SetConfig(cfg)
 		u.cfg.SetupCompleted = true
 		if err := u.cfg.Save(); err != nil {
 			dialog.ShowError(fmt.Errorf("failed to save config: %v", err), u.win)
 			return
 		}
-		u.cli.SetTarget(u.cfg.IP, u.cfg.Port, u.cfg.GetTimeout(), u.cfg.SetTimeout())
-		u.status.SetText(fmt.Sprintf("Connection set → %s:%d", ip, p))
+		v.applyConfig()
+		u.configChanged(v, "connection")
+		v.status.SetText(fmt.Sprintf("Connection set → %s:%d", ip, p))
 
 		// Kick an initial poll and close the dialog.
-		go u.pollOnce()
+		go v.dev.PollOnce()
 		if d != nil {
 			d.Hide()
 		}
 	})
 
+	findBtn := widget.NewButton("Find on Network…", func() {
+		port, err := strconv.Atoi(strings.TrimSpace(portEntry.Text))
+		if err != nil || port < 1 || port > 65535 {
+			port = cfg.Port
+		}
+		u.showDiscoveryDialog(port, func(r discovery.Result) {
+			ipEntry.SetText(r.IP)
+			portEntry.SetText(strconv.Itoa(r.Port))
+		})
+	})
+
 	body := container.NewVBox(
 		title,
 		widget.NewSeparator(),
 		desc,
 		form,
-		container.NewHBox(layout.NewSpacer(), saveBtn),
+		container.NewHBox(findBtn, layout.NewSpacer(), saveBtn),
 	)
 
 	d = dialog.NewCustomWithoutButtons("First-Time Setup", body, u.win)
-	d.Resize(fyne.NewSize(520, 320))
+	d.Resize(fyne.NewSize(560, 360))
 	d.Show()
 }
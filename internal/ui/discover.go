@@ -0,0 +1,137 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+	"github.com/SiirRandall/tesmart-ui/internal/discovery"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+/* Discovery */
+
+// showDiscoveryDialog scans the LAN for switches listening on port; adopt is
+// called on the UI thread when the user picks one.
+func (u *AppUI) showDiscoveryDialog(port int, adopt func(discovery.Result)) {
+	subnetEntry := widget.NewEntry()
+	subnetEntry.SetPlaceHolder("e.g., 192.168.1.0/24")
+	subnetEntry.SetText(strings.Join(discovery.LocalSubnets(), ", "))
+
+	portEntry := widget.NewEntry()
+	portEntry.SetPlaceHolder("5000")
+	portEntry.SetText(strconv.Itoa(port))
+
+	progress := widget.NewProgressBar()
+	status := widget.NewLabel("Enter one or more subnets and press Scan.")
+	rows := container.NewVBox()
+
+	var (
+		d      dialog.Dialog
+		cancel context.CancelFunc
+		scanID int
+	)
+	addRow := func(r discovery.Result) {
+		label := widget.NewLabel(fmt.Sprintf("%s — input %d (%d ms)", r.Addr(), r.Active, r.Latency.Milliseconds()))
+		btn := widget.NewButton("Use", func() {
+			if cancel != nil {
+				cancel()
+			}
+			d.Hide()
+			adopt(r)
+		})
+		rows.Add(container.NewHBox(label, layout.NewSpacer(), btn))
+	}
+
+	var scanBtn *widget.Button
+	scanBtn = widget.NewButton("Scan", func() {
+		if cancel != nil {
+			cancel()
+			return
+		}
+		p, err := strconv.Atoi(strings.TrimSpace(portEntry.Text))
+		if err != nil || p < 1 || p > 65535 {
+			dialog.ShowError(fmt.Errorf("invalid port"), u.win)
+			return
+		}
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		scanID++
+		id := scanID
+		rows.RemoveAll()
+		progress.SetValue(0)
+		status.SetText("Scanning…")
+		scanBtn.SetText("Stop")
+
+		subnets := subnetEntry.Text
+		go func() {
+			res, err := discovery.Scan(ctx, subnets, discovery.Options{
+				Port:       p,
+				OnResult:   func(r discovery.Result) { fyne.Do(func() { addRow(r) }) },
+				OnProgress: func(n, total int) { fyne.Do(func() { progress.SetValue(float64(n) / float64(total)) }) },
+			})
+			fyne.Do(func() {
+				if id != scanID {
+					return // superseded by a newer scan
+				}
+				cancel = nil
+				scanBtn.SetText("Scan")
+				switch {
+				case err != nil && ctx.Err() == nil:
+					status.SetText("Scan failed: " + err.Error())
+				case len(res) == 0:
+					status.SetText("No switches found.")
+				default:
+					status.SetText(fmt.Sprintf("Found %d switch(es).", len(res)))
+				}
+			})
+		}()
+	})
+
+	form := widget.NewForm(
+		widget.NewFormItem("Subnets", subnetEntry),
+		widget.NewFormItem("KVM Port", portEntry),
+	)
+	top := container.NewVBox(form, container.NewHBox(layout.NewSpacer(), scanBtn), progress, status)
+	body := container.NewBorder(top, nil, nil, nil, container.NewVScroll(rows))
+
+	d = dialog.NewCustom("Find Switches on Network", "Close", body, u.win)
+	d.SetOnClosed(func() {
+		if cancel != nil {
+			cancel()
+		}
+	})
+	d.Resize(fyne.NewSize(560, 480))
+	d.Show()
+}
+
+// adoptDiscovered adds a found switch as a new device, unless it is already
+// configured.
+func (u *AppUI) adoptDiscovered(r discovery.Result) {
+	for i, v := range u.views {
+		if dc := v.dev.Config(); dc.IP == r.IP && dc.Port == r.Port {
+			u.tabs.SelectIndex(i)
+			dialog.ShowInformation("Find Switches", fmt.Sprintf("%s is already configured as %q.", r.Addr(), v.dev.Name()), u.win)
+			return
+		}
+	}
+	dc := u.cfg.AddDevice(&config.Device{IP: r.IP, Port: r.Port})
+	if err := u.cfg.Save(); err != nil {
+		dialog.ShowError(fmt.Errorf("failed to save config: %v", err), u.win)
+		return
+	}
+	v := u.addView(device.New(dc, u.cfg.SwitchSuppress()))
+	v.start()
+	u.configChanged(v, "added")
+	u.tabs.Select(v.tab)
+	u.refreshTray()
+	v.status.SetText(fmt.Sprintf("Added %s — check the model under File → Connection…", r.Addr()))
+}
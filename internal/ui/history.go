@@ -0,0 +1,113 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/history"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// historyRanges are the periods the usage tab can total over.
+var historyRanges = []string{"Today", "This week", "Last 7 days", "Last 30 days", "All time"}
+
+func rangeStart(name string, now time.Time) time.Time {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch name {
+	case "Today":
+		return midnight
+	case "This week": // since Monday
+		return midnight.AddDate(0, 0, -(int(now.Weekday())+6)%7)
+	case "Last 7 days":
+		return now.AddDate(0, 0, -7)
+	case "Last 30 days":
+		return now.AddDate(0, 0, -30)
+	}
+	return time.Time{}
+}
+
+// showHistory opens a window with the recent input changes and how long
+// each input was in use.
+func (u *AppUI) showHistory() {
+	entries, err := history.Load(u.cfg.Dir())
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("failed to read history: %v", err), u.win)
+		return
+	}
+	win := u.app.NewWindow("History")
+
+	// Usage: totals per input over the chosen range.
+	usage := container.NewGridWithColumns(3)
+	showUsage := func(rng string) {
+		now := time.Now()
+		bold := fyne.TextStyle{Bold: true}
+		usage.Objects = []fyne.CanvasObject{
+			widget.NewLabelWithStyle("Switch", fyne.TextAlignLeading, bold),
+			widget.NewLabelWithStyle("Input", fyne.TextAlignLeading, bold),
+			widget.NewLabelWithStyle("Time", fyne.TextAlignTrailing, bold),
+		}
+		for _, t := range history.Dwell(entries, rangeStart(rng, now), now) {
+			usage.Objects = append(usage.Objects,
+				widget.NewLabel(t.Device),
+				widget.NewLabel(fmt.Sprintf("%d · %s", t.Port, t.Name)),
+				widget.NewLabelWithStyle(formatDwell(t.Time), fyne.TextAlignTrailing, fyne.TextStyle{}),
+			)
+		}
+		usage.Refresh()
+	}
+	rangeSel := widget.NewSelect(historyRanges, showUsage)
+	rangeSel.SetSelected("Today")
+
+	// Recent: newest first.
+	recent := widget.NewList(
+		func() int { return len(entries) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			e := entries[len(entries)-1-i]
+			text := fmt.Sprintf("%s   %s → %d · %s   (%s)", e.Time.Format("Mon 2 Jan 15:04:05"), e.Device, e.Port, e.Name, e.Source)
+			if e.Source == history.SourceStop {
+				text = fmt.Sprintf("%s   %s: no longer watched", e.Time.Format("Mon 2 Jan 15:04:05"), e.Device)
+			}
+			o.(*widget.Label).SetText(text)
+		},
+	)
+
+	export := func(name string, write func(io.Writer, []history.Entry) error) {
+		d := dialog.NewFileSave(func(w fyne.URIWriteCloser, err error) {
+			if err != nil || w == nil {
+				return
+			}
+			defer w.Close()
+			if err := write(w, entries); err != nil {
+				dialog.ShowError(fmt.Errorf("export failed: %v", err), win)
+			}
+		}, win)
+		d.SetFileName(name)
+		d.Show()
+	}
+	buttons := container.NewHBox(
+		widget.NewButton("Export CSV…", func() { export("tesmart-history.csv", history.WriteCSV) }),
+		widget.NewButton("Export JSON…", func() { export("tesmart-history.json", history.WriteJSON) }),
+	)
+
+	tabs := container.NewAppTabs(
+		container.NewTabItem("Usage", container.NewBorder(rangeSel, nil, nil, nil, container.NewVScroll(usage))),
+		container.NewTabItem("Recent Changes", recent),
+	)
+	win.SetContent(container.NewBorder(nil, buttons, nil, nil, tabs))
+	win.Resize(fyne.NewSize(620, 440))
+	win.Show()
+}
+
+func formatDwell(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if h := int(d.Hours()); h > 0 {
+		return fmt.Sprintf("%dh %02dm", h, int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dm", int(d.Minutes()))
+}
@@ -0,0 +1,95 @@
+package ui
+
+import (
+	"errors"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+
+	"fyne.io/fyne/v2"
+)
+
+// The methods in this file serve commands forwarded from other tesmart-ui
+// processes and may be called from any goroutine.
+
+// Device returns the switch named name (the first if empty), or nil.
+func (u *AppUI) Device(name string) *device.Device {
+	var d *device.Device
+	fyne.DoAndWait(func() {
+		for _, v := range u.views {
+			if name == "" || v.dev.Name() == name {
+				d = v.dev
+				return
+			}
+		}
+	})
+	return d
+}
+
+// ShowWindow brings the main window to the front.
+func (u *AppUI) ShowWindow() error {
+	var ok bool
+	fyne.DoAndWait(func() { ok = u.showWindow() })
+	if !ok {
+		return errors.New("no window to show")
+	}
+	return nil
+}
+
+// ReloadConfig re-reads the config file. Switches are matched by name:
+// existing ones are reconfigured, new ones get a tab and missing ones are
+// removed. api_listen and mqtt take effect on the next start.
+func (u *AppUI) ReloadConfig() error {
+	nc, err := config.Load()
+	if err != nil {
+		return err
+	}
+	fyne.DoAndWait(func() { u.applyConfigFile(nc) })
+	return nil
+}
+
+func (u *AppUI) applyConfigFile(nc *config.Config) {
+	u.cfg.FastMode = nc.FastMode
+	u.cfg.VerifyAfterSet = nc.VerifyAfterSet
+	u.cfg.SwitchSuppressMs = nc.SwitchSuppressMs
+	u.cfg.Presets = nc.Presets
+	u.cfg.Schedules, u.cfg.ScheduleMissed = nc.Schedules, nc.ScheduleMissed
+	u.cfg.Hooks, u.cfg.HookTimeoutMs = nc.Hooks, nc.HookTimeoutMs
+
+	keep := map[*deviceView]bool{}
+	devices := make([]*config.Device, 0, len(nc.Devices))
+	for _, dc := range nc.Devices {
+		var v *deviceView
+		for _, x := range u.views {
+			if x.dev.Name() == dc.Name && !keep[x] {
+				v = x
+				break
+			}
+		}
+		if v != nil {
+			v.dev.SetConfig(dc)
+			dc = u.cfg.Device(dc.Name) // the entry v.dev was built from, now updated
+			v.applyConfig()
+			v.start()
+			u.configChanged(v, "reloaded")
+		} else {
+			v = u.addView(device.New(dc, u.cfg.SwitchSuppress()))
+			v.start()
+			u.configChanged(v, "added")
+		}
+		keep[v] = true
+		devices = append(devices, dc)
+	}
+	for _, v := range append([]*deviceView(nil), u.views...) {
+		if !keep[v] {
+			u.removeView(v)
+			u.configChanged(v, "removed")
+		}
+	}
+	u.cfg.Devices = devices
+	u.schedule.Reload()
+	u.hooks.Reload()
+	u.win.SetTitle(u.windowTitle())
+	u.win.SetMainMenu(u.buildMenu())
+	u.refreshTray()
+}
@@ -0,0 +1,127 @@
+package ui
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+	"github.com/SiirRandall/tesmart-ui/internal/history"
+	"github.com/SiirRandall/tesmart-ui/internal/hooks"
+	"github.com/SiirRandall/tesmart-ui/internal/mqtt"
+	"github.com/SiirRandall/tesmart-ui/internal/schedule"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+	"github.com/SiirRandall/tesmart-ui/internal/server"
+
+	"fyne.io/fyne/v2"
+)
+
+// startIntegrations starts the history recorder, hook runner, scheduler and
+// D-Bus service, and the HTTP API and MQTT bridge if configured.
+func (u *AppUI) startIntegrations() {
+	u.history = history.NewRecorder(u.cfg.Dir(), u.events)
+	u.history.Start()
+	u.hooks = hooks.New(u.cfg, u.events)
+	u.hooks.Start()
+	u.schedule = schedule.New(u.cfg, u.Device)
+	u.schedule.Start()
+	u.startDBus()
+	u.startAPI()
+	if u.cfg.MQTT.Broker != "" {
+		u.mqtt = mqtt.New(u.cfg, nil, u.events)
+		u.syncIntegrations()
+		u.mqtt.Start()
+	}
+}
+
+func (u *AppUI) stopIntegrations() {
+	u.hooks.Close()
+	u.schedule.Close()
+	if u.apiHTTP != nil {
+		_ = u.apiHTTP.Close()
+	}
+	if u.mqtt != nil {
+		u.mqtt.Close()
+	}
+	if u.dbus != nil {
+		_ = u.dbus.Close()
+	}
+	u.history.Close()
+}
+
+// startAPI serves the HTTP API on cfg.APIListen, sharing the GUI's devices
+// and pollers. Failing to listen is logged, not fatal.
+func (u *AppUI) startAPI() {
+	if u.cfg.APIListen == "" {
+		return
+	}
+	ln, err := net.Listen("tcp", u.cfg.APIListen)
+	if err != nil {
+		log.Printf("[api] %v", err)
+		return
+	}
+	u.api = server.New(u.cfg, nil, u.events)
+	u.syncIntegrations()
+	u.apiHTTP = &http.Server{Handler: u.api.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := u.apiHTTP.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[api] %v", err)
+		}
+	}()
+	go u.watchConfigEvents()
+	log.Printf("[api] serving on http://%s", ln.Addr())
+}
+
+// syncIntegrations tells the API server and MQTT bridge about added or
+// removed switches.
+func (u *AppUI) syncIntegrations() {
+	devs := make([]*device.Device, len(u.views))
+	for i, v := range u.views {
+		devs[i] = v.dev
+	}
+	if u.api != nil {
+		u.api.SetDevices(devs)
+	}
+	if u.mqtt != nil {
+		u.mqtt.SetDevices(devs)
+	}
+}
+
+// configChanged announces an edit of v's settings ("ports", "connection",
+// "added" or "removed").
+func (u *AppUI) configChanged(v *deviceView, what string) {
+	u.events.Publish(schema.Event{Type: schema.EventConfigChanged, Device: v.dev.Name(), What: what})
+}
+
+// watchConfigEvents redraws a switch's tiles when its ports are renamed
+// through the API.
+func (u *AppUI) watchConfigEvents() {
+	_, ch, _ := u.events.Subscribe(0)
+	for {
+		for e := range ch {
+			u.onConfigEvent(e)
+		}
+		// Fell behind; catch up from the history.
+		var backlog []schema.Event
+		backlog, ch, _ = u.events.Subscribe(0)
+		for _, e := range backlog {
+			u.onConfigEvent(e)
+		}
+	}
+}
+
+func (u *AppUI) onConfigEvent(e schema.Event) {
+	if e.Type != schema.EventConfigChanged || e.What != "ports" {
+		return
+	}
+	fyne.Do(func() {
+		for _, v := range u.views {
+			if v.dev.Name() == e.Device {
+				v.buildTiles()
+				u.refreshTray()
+			}
+		}
+	})
+}
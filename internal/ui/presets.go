@@ -0,0 +1,66 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+	"github.com/SiirRandall/tesmart-ui/internal/preset"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+)
+
+// presetItems lists the configured presets as menu items; nil if there are none.
+func (u *AppUI) presetItems(source string) []*fyne.MenuItem {
+	var items []*fyne.MenuItem
+	for _, p := range u.cfg.Presets {
+		p := p
+		items = append(items, fyne.NewMenuItem(p.Name, func() { u.runPreset(p, source) }))
+	}
+	return items
+}
+
+// runPreset runs p off the UI goroutine and reports each step: in a dialog
+// from the main menu, as a notification from the tray.
+func (u *AppUI) runPreset(p config.Preset, source string) {
+	verify := u.cfg.VerifySwitch()
+	go func() {
+		res, err := preset.Run(context.Background(), &p, u.Device, verify, source)
+		var lines []string
+		for i, s := range res.Steps {
+			what := s.Action + " " + s.Value
+			if s.Action == "" {
+				what = fmt.Sprintf("step %d", i+1)
+			}
+			if s.Error != nil {
+				msg := s.Error.Message
+				if s.Error.Hint != "" {
+					msg = s.Error.Hint
+				}
+				lines = append(lines, fmt.Sprintf("✗ %s: %s — %s", s.Device, what, msg))
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("✓ %s: %s", s.Device, what))
+		}
+		title := "Preset Applied"
+		if err != nil {
+			title = "Preset Failed"
+			log.Printf("[preset] %s: %v", p.Name, err)
+		}
+		if source == schema.SourceTray {
+			content := fmt.Sprintf("%s: all %d steps done", p.Name, len(res.Steps))
+			if err != nil {
+				content = fmt.Sprintf("%s: %v", p.Name, err)
+			}
+			u.app.SendNotification(&fyne.Notification{Title: title, Content: content})
+			return
+		}
+		fyne.Do(func() {
+			dialog.ShowInformation(title, p.Name+"\n\n"+strings.Join(lines, "\n"), u.win)
+		})
+	}()
+}
@@ -0,0 +1,63 @@
+package ui
+
+import (
+	"time"
+
+	"github.com/SiirRandall/tesmart-ui/internal/config"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// showSchedule lists the configured schedules by their next run.
+func (u *AppUI) showSchedule() {
+	up := u.schedule.Upcoming()
+	if len(up) == 0 {
+		dialog.ShowInformation("Schedule", "No schedules configured.\n\nAdd them under schedules: in "+u.cfg.Path()+".", u.win)
+		return
+	}
+
+	bold := fyne.TextStyle{Bold: true}
+	cells := []fyne.CanvasObject{
+		widget.NewLabelWithStyle("Next Run", fyne.TextAlignLeading, bold),
+		widget.NewLabelWithStyle("Rule", fyne.TextAlignLeading, bold),
+		widget.NewLabelWithStyle("Switch", fyne.TextAlignLeading, bold),
+		widget.NewLabelWithStyle("Input", fyne.TextAlignLeading, bold),
+	}
+	now := time.Now()
+	for _, e := range up {
+		next := "never"
+		switch {
+		case e.Err != nil:
+			next = "invalid: " + e.Err.Error()
+		case !e.Next.IsZero() && e.Next.Year() == now.Year() && e.Next.YearDay() == now.YearDay():
+			next = "today " + e.Next.Format("15:04")
+		case !e.Next.IsZero():
+			next = e.Next.Format("Mon 2 Jan 15:04")
+		}
+		name := e.Rule.Name
+		if name == "" {
+			name = e.Rule.Cron
+		}
+		sw, input := e.Rule.Device, e.Rule.Input
+		for _, v := range u.views {
+			if sw == "" || v.dev.Name() == sw {
+				sw = v.dev.Name()
+				dc := v.dev.Config()
+				if p, err := dc.ResolveInput(input); err == nil {
+					input = dc.InputName(p)
+				}
+				break
+			}
+		}
+		cells = append(cells, widget.NewLabel(next), widget.NewLabel(name), widget.NewLabel(sw), widget.NewLabel(input))
+	}
+	missed := "Runs missed while asleep are skipped."
+	if u.cfg.ScheduleMissed == config.MissedRunLatest {
+		missed = "After sleep, the latest missed run is made up."
+	}
+	content := container.NewVBox(container.NewGridWithColumns(4, cells...), widget.NewLabel(missed))
+	dialog.ShowCustom("Schedule", "Close", container.NewVScroll(content), u.win)
+}
@@ -8,6 +8,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/SiirRandall/tesmart-ui/internal/client"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/widget"
@@ -88,6 +91,22 @@ func showAnyRealWindow(app fyne.App) bool {
 	return shown
 }
 
+// showWindow brings the main window back from the tray. It must run on the
+// UI thread.
+func (u *AppUI) showWindow() bool {
+	if w := getMainWinRef(u.app); isRealAppWindow(w) {
+		w.Show()
+		w.RequestFocus()
+		w.CenterOnScreen()
+		return true
+	}
+	if showAnyRealWindow(u.app) {
+		return true
+	}
+	log.Println("[tray] Show Window: no real app window available")
+	return false
+}
+
 // EnableSystemTray installs the tray/menu and makes Close -> Hide on the real window.
 func (u *AppUI) EnableSystemTray() {
 	app := fyne.CurrentApp()
@@ -100,6 +119,7 @@ func (u *AppUI) EnableSystemTray() {
 	if desk, ok := app.(desktop.App); ok {
 		setTrayIcon(desk) // <— use the helper
 		desk.SetSystemTrayMenu(u.buildTrayMenu(app))
+		u.trayEnabled = true
 		log.Println("[tray] system tray menu installed")
 	} else {
 		log.Println("[tray] desktop.App not available (non-desktop build?)")
@@ -135,17 +155,63 @@ func (u *AppUI) EnableSystemTray() {
 	})
 }
 
-func (u *AppUI) buildTrayMenu(app fyne.App) *fyne.Menu { // Submenu: All Inputs (from config)
-	inputNames := u.InputNames()
+// refreshTray rebuilds the tray menu after port names or the model change.
+func (u *AppUI) refreshTray() {
+	if !u.trayEnabled {
+		return
+	}
+	if desk, ok := u.app.(desktop.App); ok {
+		desk.SetSystemTrayMenu(u.buildTrayMenu(u.app))
+	}
+}
+
+func (u *AppUI) buildTrayMenu(app fyne.App) *fyne.Menu {
+	// One input submenu per switch; a lone switch keeps the "All Inputs" label.
+	var inputItems []*fyne.MenuItem
+	for _, v := range u.views {
+		label := v.dev.Name()
+		if len(u.views) == 1 {
+			label = "All Inputs"
+		}
+		item := fyne.NewMenuItem(label, nil)
+		item.ChildMenu = v.trayInputMenu(app, label)
+		inputItems = append(inputItems, item)
+	}
+
+	showItem := fyne.NewMenuItem("Show Window", func() {
+		if !u.showWindow() {
+			widget.ShowPopUp(widget.NewLabel("No window available to show."), nil)
+		}
+	})
+
+	configItem := fyne.NewMenuItem("Config…", func() {
+		// hook your settings UI if you like
+	})
+	quitItem := fyne.NewMenuItem("Quit", func() { app.Quit() })
+
+	items := []*fyne.MenuItem{showItem, fyne.NewMenuItemSeparator()}
+	items = append(items, inputItems...)
+	if presets := u.presetItems(schema.SourceTray); len(presets) > 0 {
+		item := fyne.NewMenuItem("Presets", nil)
+		item.ChildMenu = fyne.NewMenu("Presets", presets...)
+		items = append(items, item)
+	}
+	items = append(items, configItem, fyne.NewMenuItemSeparator(), quitItem)
+	return fyne.NewMenu("TeSmart UI", items...)
+}
+
+// trayInputMenu lists the device's inputs (from config).
+func (v *deviceView) trayInputMenu(app fyne.App, title string) *fyne.Menu {
+	inputNames := v.InputNames()
 	items := make([]*fyne.MenuItem, 0, len(inputNames))
 	for _, name := range inputNames {
 		n := name
 		items = append(items, fyne.NewMenuItem(n, func() {
-			if err := u.SwitchInput(n); err != nil {
-				log.Printf("[tray] switch %q failed: %v\n", n, err)
+			if err := v.SwitchInput(n); err != nil {
+				log.Printf("[tray] %s: switch %q failed: %v\n", v.dev.Name(), n, err)
 				app.SendNotification(&fyne.Notification{
 					Title:   "Switch Failed",
-					Content: fmt.Sprintf("Could not switch to %s: %v", n, err),
+					Content: fmt.Sprintf("Could not switch to %s: %s", n, client.Hint(err)),
 				})
 				return
 			}
@@ -155,35 +221,5 @@ func (u *AppUI) buildTrayMenu(app fyne.App) *fyne.Menu { // Submenu: All Inputs
 			})
 		}))
 	}
-	allInputsSub := fyne.NewMenu("All Inputs", items...)
-	allInputsItem := fyne.NewMenuItem("All Inputs", nil)
-	allInputsItem.ChildMenu = allInputsSub
-
-	showItem := fyne.NewMenuItem("Show Window", func() {
-		if w := getMainWinRef(app); isRealAppWindow(w) {
-			w.Show()
-			w.RequestFocus()
-			w.CenterOnScreen()
-			return
-		}
-		if showAnyRealWindow(app) {
-			return
-		}
-		log.Println("[tray] Show Window: no real app window available")
-		widget.ShowPopUp(widget.NewLabel("No window available to show."), nil)
-	})
-
-	configItem := fyne.NewMenuItem("Config…", func() {
-		// hook your settings UI if you like
-	})
-	quitItem := fyne.NewMenuItem("Quit", func() { app.Quit() })
-
-	return fyne.NewMenu("TeSmart UI",
-		showItem,
-		fyne.NewMenuItemSeparator(),
-		allInputsItem,
-		configItem,
-		fyne.NewMenuItemSeparator(),
-		quitItem,
-	)
+	return fyne.NewMenu(title, items...)
 }
@@ -1,71 +1,74 @@
 package ui
 
 import (
-	"fmt"
+	"io"
+	"net/http"
 	"os/exec"
 	"runtime"
-	"sync"
-	"time"
 
-	"github.com/SiirRandall/tesmart-ui/internal/client"
 	"github.com/SiirRandall/tesmart-ui/internal/config"
-	"github.com/SiirRandall/tesmart-ui/internal/widgets"
+	"github.com/SiirRandall/tesmart-ui/internal/device"
+	"github.com/SiirRandall/tesmart-ui/internal/events"
+	"github.com/SiirRandall/tesmart-ui/internal/history"
+	"github.com/SiirRandall/tesmart-ui/internal/hooks"
+	"github.com/SiirRandall/tesmart-ui/internal/mqtt"
+	"github.com/SiirRandall/tesmart-ui/internal/schedule"
+	"github.com/SiirRandall/tesmart-ui/internal/schema"
+	"github.com/SiirRandall/tesmart-ui/internal/server"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
-	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 )
 
 type AppUI struct {
-	cfg          *config.Config
-	cli          *client.Client
-	app          fyne.App
-	win          fyne.Window
-	status       *widget.Label
-	tiles        map[int]*widgets.PortTile
-	ticker       *time.Ticker
-	doneCh       chan struct{}
-	pendingMu    sync.Mutex
-	pendingPort  int
-	pendingUntil time.Time
+	cfg         *config.Config
+	app         fyne.App
+	win         fyne.Window
+	tabs        *container.AppTabs
+	views       []*deviceView
+	trayEnabled bool
+
+	events   *events.Bus
+	api      *server.Server // nil unless api_listen is set
+	apiHTTP  *http.Server
+	mqtt     *mqtt.Bridge // nil unless mqtt.broker is set
+	dbus     io.Closer    // session bus connection (Linux)
+	hooks    *hooks.Runner
+	schedule *schedule.Scheduler
+	history  *history.Recorder
 }
 
-func NewAppUI(cfg *config.Config, cli *client.Client) *AppUI {
-	return &AppUI{
-		cfg:   cfg,
-		cli:   cli,
-		app:   app.New(),
-		tiles: map[int]*widgets.PortTile{},
+func NewAppUI(cfg *config.Config, devs []*device.Device) *AppUI {
+	u := &AppUI{
+		cfg:    cfg,
+		app:    app.New(),
+		tabs:   container.NewAppTabs(),
+		events: events.NewBus(256),
 	}
+	for _, d := range devs {
+		u.addView(d)
+	}
+	return u
 }
 
 func (u *AppUI) Run() {
-	u.win = u.app.NewWindow("TeSmart 16-Port HDMI Switch")
-	u.win.Resize(fyne.NewSize(700, 680))
-
-	gridWrap := container.New(layout.NewGridWrapLayout(fyne.NewSize(170, 140)))
-
-	for i := 1; i <= 16; i++ {
-		meta := u.cfg.Ports[i]
-		iconRes := loadIcon(u.cfg.Dir(), meta.Icon)
-		port := i
-		t := widgets.NewPortTile(port, meta.Name, iconRes, func() {
-			u.beginPending(port, time.Duration(u.cfg.SwitchSuppressMs)*time.Millisecond)
-			u.setActiveHighlight(port)
-			go u.switchTo(port)
-		})
-		u.tiles[i] = t
-		gridWrap.Add(container.NewPadded(t))
-	}
+	u.win = u.app.NewWindow(u.windowTitle())
+	u.win.Resize(fyne.NewSize(700, 720))
 
-	u.status = widget.NewLabel(fmt.Sprintf("Connected to %s:%d", u.cfg.IP, u.cfg.Port))
+	u.tabs.OnSelected = func(*container.TabItem) { u.win.SetTitle(u.windowTitle()) }
 
 	u.win.SetMainMenu(u.buildMenu())
-	u.win.SetContent(container.NewBorder(u.buildToolbar(), u.status, nil, nil, gridWrap))
-	u.win.SetOnClosed(func() { u.stopPoller() })
+	u.win.SetContent(container.NewBorder(u.buildToolbar(), nil, nil, nil, u.tabs))
+	u.win.SetOnClosed(func() {
+		u.stopIntegrations()
+		for _, v := range u.views {
+			v.dev.Close()
+		}
+	})
+	u.startIntegrations()
 
 	// First-run setup: if not completed, show the setup dialog immediately.
 	if !u.cfg.SetupCompleted || u.cfg.WasJustCreated() {
@@ -73,24 +76,64 @@ func (u *AppUI) Run() {
 		fyne.Do(func() { u.showFirstSetupDialog() })
 	}
 
-	u.startPoller(u.cfg.PollIntervalMs)
+	for _, v := range u.views {
+		v.start()
+	}
 	u.win.ShowAndRun()
 }
 
+// addView creates the tab for d.
+func (u *AppUI) addView(d *device.Device) *deviceView {
+	d.Events = u.events
+	v := newDeviceView(u, d)
+	u.views = append(u.views, v)
+	u.tabs.Append(v.tab)
+	u.syncIntegrations()
+	return v
+}
+
+// removeView stops v's device and drops its tab.
+func (u *AppUI) removeView(v *deviceView) {
+	v.dev.Close()
+	u.tabs.Remove(v.tab)
+	for i, x := range u.views {
+		if x == v {
+			u.views = append(u.views[:i], u.views[i+1:]...)
+			break
+		}
+	}
+	u.syncIntegrations()
+}
+
+// current returns the view of the selected tab.
+func (u *AppUI) current() *deviceView {
+	if i := u.tabs.SelectedIndex(); i >= 0 && i < len(u.views) {
+		return u.views[i]
+	}
+	return u.views[0]
+}
+
+func (u *AppUI) windowTitle() string {
+	if len(u.views) == 0 {
+		return "TeSmart UI"
+	}
+	return u.current().dev.Config().Profile().Title() + " HDMI Switch"
+}
+
 func (u *AppUI) buildMenu() *fyne.MainMenu {
-	pingItem := fyne.NewMenuItem("Ping", func() { go u.doPing() })
+	pingItem := fyne.NewMenuItem("Ping", func() { go u.current().doPing() })
 
 	buzzerItem := fyne.NewMenuItem("Buzzer", nil)
 	buzzerItem.ChildMenu = fyne.NewMenu("",
-		fyne.NewMenuItem("Mute", func() { go u.doBuzzer(false) }),
-		fyne.NewMenuItem("Unmute", func() { go u.doBuzzer(true) }),
+		fyne.NewMenuItem("Mute", func() { go u.current().doBuzzer(false) }),
+		fyne.NewMenuItem("Unmute", func() { go u.current().doBuzzer(true) }),
 	)
 
 	ledItem := fyne.NewMenuItem("LED Timeout", nil)
 	ledItem.ChildMenu = fyne.NewMenu("",
-		fyne.NewMenuItem("Off (always on)", func() { go u.doTimeout("off") }),
-		fyne.NewMenuItem("10 seconds", func() { go u.doTimeout("10s") }),
-		fyne.NewMenuItem("30 seconds", func() { go u.doTimeout("30s") }),
+		fyne.NewMenuItem("Off (always on)", func() { go u.current().doTimeout("off") }),
+		fyne.NewMenuItem("10 seconds", func() { go u.current().doTimeout("10s") }),
+		fyne.NewMenuItem("30 seconds", func() { go u.current().doTimeout("30s") }),
 	)
 
 	rawItem := fyne.NewMenuItem("Send Raw Hex…", func() { u.showRawDialog() })
@@ -110,12 +153,22 @@ func (u *AppUI) buildMenu() *fyne.MainMenu {
 	fileMenu := fyne.NewMenu("File",
 		fyne.NewMenuItem("Connection…", func() { u.showConnectionDialog() }),
 		fyne.NewMenuItem("Edit Names / Icons…", func() { u.showEditDialog() }),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Add Switch…", func() { u.showAddDeviceDialog() }),
+		fyne.NewMenuItem("Find Switches on Network…", func() { u.showDiscoveryDialog(u.current().dev.Config().Port, u.adoptDiscovered) }),
+		fyne.NewMenuItem("Remove Switch…", func() { u.confirmRemoveDevice() }),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("History…", func() { u.showHistory() }),
+		fyne.NewMenuItem("Schedule…", func() { u.showSchedule() }),
 		fyne.NewMenuItem("Open Config Folder…", func() { openFolder(u.cfg.Dir()) }),
 		fyne.NewMenuItemSeparator(),
 		fyne.NewMenuItem("Quit", func() { u.app.Quit() }),
 	)
 
 	helpMenu := fyne.NewMenu("Help", fyne.NewMenuItem("About", func() { u.showAbout() }))
+	if items := u.presetItems(schema.SourceUI); len(items) > 0 {
+		return fyne.NewMainMenu(fileMenu, deviceMenu, fyne.NewMenu("Presets", items...), helpMenu)
+	}
 	return fyne.NewMainMenu(fileMenu, deviceMenu, helpMenu)
 }
 
@@ -124,120 +177,11 @@ func (u *AppUI) buildToolbar() *widget.Toolbar {
 		widget.NewToolbarAction(theme.SettingsIcon(), func() { u.showConnectionDialog() }),
 		widget.NewToolbarAction(theme.DocumentIcon(), func() { u.showEditDialog() }),
 		widget.NewToolbarAction(theme.ComputerIcon(), func() { u.showNetworkConfigDialog() }),
-		widget.NewToolbarAction(theme.MediaPlayIcon(), func() { go u.doPing() }),
+		widget.NewToolbarAction(theme.MediaPlayIcon(), func() { go u.current().doPing() }),
 		widget.NewToolbarAction(theme.InfoIcon(), func() { u.showAbout() }),
 	)
 }
 
-/* Polling logic */
-
-func (u *AppUI) startPoller(intervalMs int) {
-	u.stopPoller()
-	u.ticker = time.NewTicker(time.Duration(intervalMs) * time.Millisecond)
-	u.doneCh = make(chan struct{})
-	go func() {
-		u.pollOnce()
-		for {
-			select {
-			case <-u.ticker.C:
-				u.pollOnce()
-			case <-u.doneCh:
-				return
-			}
-		}
-	}()
-}
-
-func (u *AppUI) stopPoller() {
-	if u.ticker != nil {
-		u.ticker.Stop()
-	}
-	if u.doneCh != nil {
-		close(u.doneCh)
-	}
-}
-
-func (u *AppUI) pollOnce() {
-	port, err := u.cli.GetActiveInput()
-	if err != nil {
-		fyne.Do(func() { u.status.SetText("Polling error: " + err.Error()) })
-		return
-	}
-	if u.shouldIgnore(port) {
-		return
-	}
-	u.clearPendingIfMatch(port)
-	fyne.Do(func() {
-		u.setActiveHighlight(port)
-		u.status.SetText(fmt.Sprintf("Active: %d", port))
-	})
-}
-
-func (u *AppUI) switchTo(port int) {
-	if err := u.cli.SetInput(port); err != nil {
-		fyne.Do(func() {
-			u.status.SetText("Switch failed")
-			dialog := widget.NewLabel(err.Error())
-			_ = dialog // you can show a dialog if desired
-		})
-		u.beginPending(0, 0)
-		return
-	}
-	if u.cfg.FastMode {
-		fyne.Do(func() { u.status.SetText(fmt.Sprintf("Switched (fast) → %d", port)) })
-		return
-	}
-	if u.cfg.VerifyAfterSet {
-		ok := false
-		for attempt := 0; attempt < 2; attempt++ {
-			time.Sleep(90 * time.Millisecond)
-			if cur, err := u.cli.GetActiveInput(); err == nil && cur == port {
-				ok = true
-				break
-			}
-		}
-		fyne.Do(func() {
-			if ok {
-				u.clearPendingIfMatch(port)
-				u.status.SetText(fmt.Sprintf("Switched to input %d", port))
-			} else {
-				u.status.SetText("Switched (unverified) — will sync on next poll")
-			}
-		})
-		return
-	}
-	fyne.Do(func() { u.status.SetText(fmt.Sprintf("Switched to input %d", port)) })
-}
-
-/* Highlight + pending window */
-
-func (u *AppUI) setActiveHighlight(n int) {
-	for i, t := range u.tiles {
-		t.SetSelected(i == n)
-	}
-}
-func (u *AppUI) beginPending(port int, dur time.Duration) {
-	u.pendingMu.Lock()
-	u.pendingPort = port
-	u.pendingUntil = time.Now().Add(dur)
-	u.pendingMu.Unlock()
-}
-func (u *AppUI) shouldIgnore(polled int) bool {
-	u.pendingMu.Lock()
-	defer u.pendingMu.Unlock()
-	if time.Now().After(u.pendingUntil) {
-		return false
-	}
-	return polled != u.pendingPort
-}
-func (u *AppUI) clearPendingIfMatch(polled int) {
-	u.pendingMu.Lock()
-	if polled == u.pendingPort {
-		u.pendingUntil = time.Time{}
-	}
-	u.pendingMu.Unlock()
-}
-
 /* Small helpers */
 
 func openFolder(path string) {
@@ -20,6 +20,7 @@ type PortTile struct {
 	content  *fyne.Container
 	PortNum  int
 	Selected bool
+	Offline  bool
 	IconRes  fyne.Resource
 	IconSize fyne.Size
 	OnTap    func()
@@ -60,14 +61,32 @@ func NewPortTile(port int, name string, icon fyne.Resource, onTap func()) *PortT
 
 func (t *PortTile) SetSelected(sel bool) {
 	t.Selected = sel
-	if sel {
+	switch {
+	case t.Offline:
+		t.bg.FillColor = color.NRGBA{R: 40, G: 40, B: 40, A: 255}
+	case sel:
 		t.bg.FillColor = color.NRGBA{R: 0, G: 120, B: 255, A: 255}
-	} else {
+	default:
 		t.bg.FillColor = color.NRGBA{R: 60, G: 60, B: 60, A: 255}
 	}
 	t.bg.Refresh()
 }
 
+// SetOffline greys the tile out while its switch is unreachable. It stays
+// tappable; a successful switch brings the switch back online.
+func (t *PortTile) SetOffline(off bool) {
+	t.Offline = off
+	t.img.Translucency = 0
+	t.label.Importance = widget.MediumImportance
+	if off {
+		t.img.Translucency = 0.6
+		t.label.Importance = widget.LowImportance
+	}
+	t.img.Refresh()
+	t.label.Refresh()
+	t.SetSelected(t.Selected)
+}
+
 func (t *PortTile) SetNameIcon(name string, icon fyne.Resource) {
 	if icon == nil {
 		icon = theme.ComputerIcon()